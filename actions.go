@@ -4,25 +4,38 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
-// Convert validation errors into slice of human readable error strings
-func humanValidationErrors(err error) []string {
+// validationError returns human readable error of field, message is translated into locale of request
+func validationError(c *gin.Context, field, message string, args ...any) string {
+	return tr(c, "[Validation error] %s: %s\n", tr(c, field), tr(c, message, args...))
+}
+
+// Convert validation errors into slice of human readable error strings in locale of request
+func humanValidationErrors(c *gin.Context, err error) []string {
 	getErrorMessage := func(field, tag string) string {
 		if tag == "required" {
-			return "[Validation error] " + field + ": Field is required\n"
+			return validationError(c, field, "Field is required")
 		}
 
 		if tag == "min" {
-			return "[Validation error] " + field + ": Field is too short\n"
+			return validationError(c, field, "Field is too short")
+		}
+
+		if tag == "max" {
+			return validationError(c, field, "Field is too long")
+		}
+
+		if tag == "url" {
+			return validationError(c, field, "Invalid URL")
 		}
 
-		return "[Validation error] " + field + ": Invalid input\n"
+		return validationError(c, field, "Invalid input")
 	}
 
 	var errorMessages []string
@@ -37,12 +50,19 @@ func humanValidationErrors(err error) []string {
 	return errorMessages
 }
 
+// isLocalPath reports whether p is path on this site, so redirecting to it can't lead elsewhere
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
+
 func addFlashesAndUser(c *gin.Context, h *gin.H) *gin.H {
 	session := sessions.Default(c)
 	flashes := session.Flashes()
 	session.Save()
 	(*h)["flashes"] = flashes
 
+	(*h)["requestID"] = c.GetString("requestID")
+
 	user, _ := c.Get("currentUser")
 	if user != nil {
 		(*h)["currentUser"] = user.(User)
@@ -53,41 +73,67 @@ func addFlashesAndUser(c *gin.Context, h *gin.H) *gin.H {
 	return h
 }
 
-func actionPublicRoot(c *gin.Context) {
-	var pages []Page
-	db.Find(&pages)
-	c.HTML(http.StatusOK, "public/index.html", &gin.H{"pages": pages})
+func (a *App) actionPublicRoot(c *gin.Context) {
+	pages, err := a.Pages.List(c.Request.Context(), PageFilter{})
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+	renderHTML(c, http.StatusOK, "public/index.html", &gin.H{"pages": a.localizePages(c, pages)})
 }
 
-func actionPublicPage(c *gin.Context) {
+func (a *App) actionPublicPage(c *gin.Context) {
 	slug := c.Param("slug")
 
-	var page Page
-
-	if err := db.Where("slug = ?", slug).First(&page).Error; err != nil {
-		c.HTML(http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"Page not found"}}))
+	page, err := a.Pages.FindBySlug(c.Request.Context(), slug)
+	if err != nil {
+		renderHTML(c, http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Page not found")}}))
 		return
 	}
 
 	pageJSON, err := json.MarshalIndent(page, "", "  ")
 	if err != nil {
-		c.HTML(http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		renderHTML(c, http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
 		return
 	}
 
-	c.HTML(http.StatusOK, "public/page.html", &gin.H{"slug": slug, "page": page, "pageJSON": string(pageJSON)})
+	// Pages missing in locale of request are shown in source locale, see localizePage
+	source := page
+	page, contentLocale := a.localizePage(c, page)
+
+	canonicalURL := localePageURL(a.baseURL(c), contentLocale, page.Slug)
+	if contentLocale == a.Config.DefaultLocale && page.CanonicalURL != "" {
+		canonicalURL = page.CanonicalURL
+	}
+
+	var ogImageURL string
+	if page.OGImage != nil {
+		ogImageURL = a.baseURL(c) + page.OGImage.URL()
+	}
+
+	renderHTML(c, http.StatusOK, "public/page.html", &gin.H{
+		"slug":          slug,
+		"page":          page,
+		"pageJSON":      string(pageJSON),
+		"content":       a.renderPageContent(c, page.Content),
+		"contentLocale": contentLocale,
+		"untranslated":  contentLocale != requestLocale(c),
+		"alternates":    a.pageAlternates(a.baseURL(c), source),
+		"canonicalURL":  canonicalURL,
+		"ogImageURL":    ogImageURL,
+	})
 }
 
-func actionPublicLoginForm(c *gin.Context) {
+func (a *App) actionPublicLoginForm(c *gin.Context) {
 	_, exists := c.Get("currentUser")
 	if exists {
 		c.Redirect(http.StatusSeeOther, "/admin/users")
 	}
 
-	c.HTML(http.StatusOK, "public/login.html", nil)
+	renderHTML(c, http.StatusOK, "public/login.html", nil)
 }
 
-func actionPublicLoginSubmit(c *gin.Context) {
+func (a *App) actionPublicLoginSubmit(c *gin.Context) {
 	_, exists := c.Get("currentUser")
 	if exists {
 		c.Redirect(http.StatusSeeOther, "/admin/users")
@@ -96,68 +142,76 @@ func actionPublicLoginSubmit(c *gin.Context) {
 	username := c.PostForm("login")
 	password := c.PostForm("password")
 
-	var user User
-	// TODO: Encrypt password
-	if err := db.Where("login = ? and password = ?", username, password).First(&user).Error; err != nil {
-		c.HTML(http.StatusUnauthorized, "public/login.html", gin.H{"errors": []string{"Invalid username or password"}})
+	user, err := a.Users.FindByCredentials(c.Request.Context(), username, password)
+	if err != nil {
+		a.metrics.logins.WithLabelValues("failure").Inc()
+		a.auditDetails(c, "login_failed", "user", 0, nil, nil, "login: "+username)
+		renderHTML(c, http.StatusUnauthorized, "public/login.html", gin.H{"errors": []string{tr(c, "Invalid username or password")}})
 		return
 	}
 
-	session := sessions.Default(c)
-	session.Set("currentUser", user.ID)
-	session.Save()
+	a.startSession(c, user)
+	a.metrics.logins.WithLabelValues("success").Inc()
+	a.audit(c, "login", "user", user.ID, nil, nil)
 
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionPublicLogout(c *gin.Context) {
+func (a *App) actionPublicLogout(c *gin.Context) {
+	if user, exists := c.Get("currentUser"); exists {
+		a.audit(c, "logout", "user", user.(User).ID, nil, nil)
+		a.metrics.logouts.Inc()
+	}
+
 	session := sessions.Default(c)
 	session.Delete("currentUser")
-	session.AddFlash("Logged out")
+	session.Delete("loggedInAt")
+	session.AddFlash(tr(c, "Logged out"))
 	session.Save()
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionAdminUsersIndex(c *gin.Context) {
-	var users []User
-	db.Find(&users)
-	c.HTML(http.StatusOK, "admin/users/index.html", addFlashesAndUser(c, &gin.H{"users": users}))
+func (a *App) actionAdminUsersIndex(c *gin.Context) {
+	users, err := a.Users.List(c.Request.Context())
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+	renderHTML(c, http.StatusOK, "admin/users/index.html", addFlashesAndUser(c, &gin.H{"users": users}))
 }
 
-func actionAdminUsersShow(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-
-	if err := db.First(&user, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"User not found"}}))
+func (a *App) actionAdminUsersShow(c *gin.Context) {
+	user, err := a.Users.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "User not found")}}))
 		return
 	}
 
 	userJSON, err := json.MarshalIndent(user, "", "  ")
 	if err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
 		return
 	}
 
-	c.HTML(http.StatusOK, "admin/users/show.html", addFlashesAndUser(c, &gin.H{"user": user, "userJSON": string(userJSON)}))
+	renderHTML(c, http.StatusOK, "admin/users/show.html", addFlashesAndUser(c, &gin.H{"user": user, "userJSON": string(userJSON)}))
 }
 
-func actionAdminIndex(c *gin.Context) {
+func (a *App) actionAdminIndex(c *gin.Context) {
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionAdminUsersNew(c *gin.Context) {
+func (a *App) actionAdminUsersNew(c *gin.Context) {
 	var user User
-	c.HTML(http.StatusOK, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"user": user}))
+	renderHTML(c, http.StatusOK, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"user": user}))
 }
 
-func actionAdminUsersCreate(c *gin.Context) {
+func (a *App) actionAdminUsersCreate(c *gin.Context) {
 	var user User
 	user.Login = c.PostForm("login")
 	// TODO: Encrypt password
 	user.Password = c.PostForm("password")
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
+	user.CreatedAt = a.now()
+	user.UpdatedAt = a.now()
 
 	user_input := &UserInput{
 		Login:    user.Login,
@@ -167,46 +221,58 @@ func actionAdminUsersCreate(c *gin.Context) {
 	// Validate user input
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(user_input); err != nil {
-		c.HTML(http.StatusBadRequest, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(err), "user": user}))
+		renderHTML(c, http.StatusBadRequest, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(c, err), "user": user}))
 		return
 	}
 
-	if err := db.Create(&user).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "user": user}))
+	if err := a.Users.Create(c.Request.Context(), &user); err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/users/new.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "user": user}))
 		return
 	}
 
+	a.audit(c, "create", "user", user.ID, nil, user)
+	a.notifyUserCreated(c, user)
+
 	session := sessions.Default(c)
-	session.AddFlash("User was added.")
+	session.AddFlash(tr(c, "User was added."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionAdminUsersEdit(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-
-	if err := db.First(&user, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"User not found"}}))
+func (a *App) actionAdminUsersEdit(c *gin.Context) {
+	user, err := a.Users.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "User not found")}}))
 		return
 	}
 
-	c.HTML(http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"user": user}))
+	renderHTML(c, http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"user": user}))
 }
 
-func actionAdminUsersUpdate(c *gin.Context) {
-	id := c.Param("id")
-	var user User
+func (a *App) actionAdminUsersUpdate(c *gin.Context) {
+	user, err := a.Users.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": tr(c, "User not found")})
+			return
+		}
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "User not found")}}))
+		return
+	}
+
+	before := user
 
-	if err := db.First(&user, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"User not found"}}))
+	// Version of the user the form was opened with
+	version, ok := formVersion(c)
+	if !ok {
+		respondMissingVersion(c)
 		return
 	}
 
 	user.Login = c.PostForm("login")
 	user.Password = c.PostForm("password")
-	user.UpdatedAt = time.Now()
+	user.UpdatedAt = a.now()
 
 	user_input := &UserInput{
 		Login:    user.Login,
@@ -216,25 +282,76 @@ func actionAdminUsersUpdate(c *gin.Context) {
 	// Validate user input
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(user_input); err != nil {
-		c.HTML(http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(err), "user": user}))
+		if wantsJSON(c) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": humanValidationErrors(c, err)})
+			return
+		}
+		user.Version = version
+		renderHTML(c, http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(c, err), "user": user}))
+		return
+	}
+
+	user.Version = version + 1
+	updated, err := a.Users.UpdateIfVersion(c.Request.Context(), &user, version)
+	if err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user.Version = version
+		renderHTML(c, http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "user": user}))
 		return
 	}
 
-	if err := db.Save(&user).Error; err != nil {
-		c.HTML(http.StatusOK, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "user": user}))
+	if !updated {
+		// Someone else saved the user after the form was opened
+		current, err := a.Users.Find(c.Request.Context(), user.ID)
+		if err != nil {
+			if wantsJSON(c) {
+				c.JSON(http.StatusNotFound, gin.H{"error": tr(c, "User not found")})
+				return
+			}
+			renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "User not found")}}))
+			return
+		}
+
+		if wantsJSON(c) {
+			c.JSON(http.StatusConflict, gin.H{"error": tr(c, "User was changed by someone else"), "current": current})
+			return
+		}
+
+		// Saving the form again overwrites the current version
+		user.Version = current.Version
+		renderHTML(c, http.StatusConflict, "admin/users/edit.html", addFlashesAndUser(c, &gin.H{"user": user, "conflict": userConflict(user, current)}))
+		return
+	}
+
+	a.audit(c, "update", "user", user.ID, before, user)
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, user)
 		return
 	}
 
 	session := sessions.Default(c)
-	session.AddFlash("User was edited.")
+	session.AddFlash(tr(c, "User was edited."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionAdminUsersDestroy(c *gin.Context) {
-	id := c.Param("id")
-	if err := db.Delete(&User{}, id).Error; err != nil {
+// actionAdminUsersDestroy moves user to trash
+func (a *App) actionAdminUsersDestroy(c *gin.Context) {
+	user, err := a.Users.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		session := sessions.Default(c)
+		session.AddFlash(tr(c, "User not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/users")
+		return
+	}
+
+	if err := a.Users.Delete(c.Request.Context(), &user); err != nil {
 		session := sessions.Default(c)
 		session.AddFlash(err.Error())
 		session.Save()
@@ -242,125 +359,264 @@ func actionAdminUsersDestroy(c *gin.Context) {
 		return
 	}
 
+	a.audit(c, "delete", "user", user.ID, user, nil)
+
 	session := sessions.Default(c)
-	session.AddFlash("User was deleted.")
+	session.AddFlash(tr(c, "User was deleted. It can be restored from trash."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/users")
 }
 
-func actionAdminPagesIndex(c *gin.Context) {
-	var pages []Page
-	db.Find(&pages)
-	c.HTML(http.StatusOK, "admin/pages/index.html", addFlashesAndUser(c, &gin.H{"pages": pages}))
-}
+func (a *App) actionAdminPagesIndex(c *gin.Context) {
+	tag := c.Query("tag")
 
-func actionAdminPagesShow(c *gin.Context) {
-	id := c.Param("id")
-	var page Page
+	pages, err := a.Pages.List(c.Request.Context(), PageFilter{Tag: tag})
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+	renderHTML(c, http.StatusOK, "admin/pages/index.html", addFlashesAndUser(c, &gin.H{"pages": pages, "tag": tag, "tagNames": a.allTagNames(c)}))
+}
 
-	if err := db.First(&page, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"Page not found"}}))
+func (a *App) actionAdminPagesShow(c *gin.Context) {
+	page, err := a.Pages.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Page not found")}}))
 		return
 	}
 
 	pageJSON, err := json.MarshalIndent(page, "", "  ")
 	if err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
 		return
 	}
 
-	c.HTML(http.StatusOK, "admin/pages/show.html", addFlashesAndUser(c, &gin.H{"page": page, "pageJSON": string(pageJSON)}))
+	renderHTML(c, http.StatusOK, "admin/pages/show.html", addFlashesAndUser(c, &gin.H{"page": page, "pageJSON": string(pageJSON)}))
 }
 
-func actionAdminPagesNew(c *gin.Context) {
+// Read OG image from form. Returns validation errors if selected media is not an image.
+func (a *App) ogImageIDFromForm(c *gin.Context) (*uint, []string) {
+	db := a.requestDB(c)
+
+	value := c.PostForm("og_image_id")
+	if value == "" {
+		return nil, nil
+	}
+
+	var media Media
+	if err := db.First(&media, value).Error; err != nil || !media.IsImage() {
+		return nil, []string{validationError(c, "OGImageID", "Invalid input")}
+	}
+	return &media.ID, nil
+}
+
+// pageFormData adds media, categories and tags used by page form
+func (a *App) pageFormData(c *gin.Context, h *gin.H) *gin.H {
+	(*h)["media"] = a.allMedia(c)
+	(*h)["categories"] = a.allCategories(c)
+	(*h)["tagNames"] = a.allTagNames(c)
+	return h
+}
+
+func (a *App) actionAdminPagesNew(c *gin.Context) {
 	var page Page
-	c.HTML(http.StatusOK, "admin/pages/new.html", addFlashesAndUser(c, &gin.H{"page": page}))
+	renderHTML(c, http.StatusOK, "admin/pages/new.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"page": page})))
 }
 
-func actionAdminPagesCreate(c *gin.Context) {
+func (a *App) actionAdminPagesCreate(c *gin.Context) {
 	var page Page
 	page.Slug = c.PostForm("slug")
 	page.Content = c.PostForm("content")
-	page.CreatedAt = time.Now()
-	page.UpdatedAt = time.Now()
+	page.Title = c.PostForm("title")
+	page.Description = c.PostForm("description")
+	page.CanonicalURL = c.PostForm("canonical_url")
+	page.NoIndex = c.PostForm("no_index") != ""
+	page.CreatedAt = a.now()
+	page.UpdatedAt = a.now()
 
 	page_input := &PageInput{
-		Slug:    page.Slug,
-		Content: page.Content,
+		Slug:         page.Slug,
+		Content:      page.Content,
+		Title:        page.Title,
+		Description:  page.Description,
+		CanonicalURL: page.CanonicalURL,
 	}
 
 	// Validate user input
+	var validationErrors []string
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(page_input); err != nil {
-		c.HTML(http.StatusBadRequest, "admin/pages/new.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(err), "page": page}))
+		validationErrors = humanValidationErrors(c, err)
+	}
+	ogImageID, ogImageErrors := a.ogImageIDFromForm(c)
+	page.OGImageID = ogImageID
+	validationErrors = append(validationErrors, ogImageErrors...)
+	categoryID, categoryErrors := a.categoryIDFromForm(c)
+	page.CategoryID = categoryID
+	page.Category = nil
+	validationErrors = append(validationErrors, categoryErrors...)
+	tags, tagErrors := tagsFromForm(c)
+	page.Tags = tags
+	validationErrors = append(validationErrors, tagErrors...)
+	if len(validationErrors) > 0 {
+		renderHTML(c, http.StatusBadRequest, "admin/pages/new.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"errors": validationErrors, "page": page})))
 		return
 	}
 
-	if err := db.Create(&page).Error; err != nil {
-		c.HTML(http.StatusInternalServerError, "admin/pages/new.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "page": page}))
+	if err := a.Pages.Create(c.Request.Context(), &page, tags); err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/pages/new.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"errors": []string{err.Error()}, "page": page})))
 		return
 	}
 
+	a.audit(c, "create", "page", page.ID, nil, page)
+
+	a.invalidateSEOCache()
+
 	session := sessions.Default(c)
-	session.AddFlash("Page was added.")
+	session.AddFlash(tr(c, "Page was added."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/pages")
 }
 
-func actionAdminPagesEdit(c *gin.Context) {
-	id := c.Param("id")
-	var page Page
-
-	if err := db.First(&page, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"User not found"}}))
+func (a *App) actionAdminPagesEdit(c *gin.Context) {
+	page, err := a.Pages.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "User not found")}}))
 		return
 	}
 
-	c.HTML(http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, &gin.H{"page": page}))
+	renderHTML(c, http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"page": page})))
 }
 
-func actionAdminPagesUpdate(c *gin.Context) {
-	id := c.Param("id")
-	var page Page
+func (a *App) actionAdminPagesUpdate(c *gin.Context) {
+	page, err := a.Pages.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusNotFound, gin.H{"error": tr(c, "Page not found")})
+			return
+		}
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Page not found")}}))
+		return
+	}
+
+	// Category is compared by category_id, the loaded one would show up as removed
+	page.Category = nil
+	before := page
 
-	if err := db.First(&page, id).Error; err != nil {
-		c.HTML(http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{"User not found"}}))
+	// Version of the page the form was opened with
+	version, ok := formVersion(c)
+	if !ok {
+		respondMissingVersion(c)
 		return
 	}
 
 	page.Slug = c.PostForm("slug")
 	page.Content = c.PostForm("content")
-	page.UpdatedAt = time.Now()
+	page.Title = c.PostForm("title")
+	page.Description = c.PostForm("description")
+	page.CanonicalURL = c.PostForm("canonical_url")
+	page.NoIndex = c.PostForm("no_index") != ""
+	page.UpdatedAt = a.now()
 
 	page_input := &PageInput{
-		Slug:    page.Slug,
-		Content: page.Content,
+		Slug:         page.Slug,
+		Content:      page.Content,
+		Title:        page.Title,
+		Description:  page.Description,
+		CanonicalURL: page.CanonicalURL,
 	}
 
 	// Validate user input
+	var validationErrors []string
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(page_input); err != nil {
-		c.HTML(http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, &gin.H{"errors": humanValidationErrors(err), "user": page}))
+		validationErrors = humanValidationErrors(c, err)
+	}
+	ogImageID, ogImageErrors := a.ogImageIDFromForm(c)
+	page.OGImageID = ogImageID
+	validationErrors = append(validationErrors, ogImageErrors...)
+	categoryID, categoryErrors := a.categoryIDFromForm(c)
+	page.CategoryID = categoryID
+	page.Category = nil
+	validationErrors = append(validationErrors, categoryErrors...)
+	tags, tagErrors := tagsFromForm(c)
+	page.Tags = tags
+	validationErrors = append(validationErrors, tagErrors...)
+	if len(validationErrors) > 0 {
+		if wantsJSON(c) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": validationErrors})
+			return
+		}
+		page.Version = version
+		renderHTML(c, http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"errors": validationErrors, "page": page})))
 		return
 	}
 
-	if err := db.Save(&page).Error; err != nil {
-		c.HTML(http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "user": page}))
+	page.Version = version + 1
+	updated, err := a.Pages.UpdateIfVersion(c.Request.Context(), &page, version, tags)
+	if err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		page.Version = version
+		renderHTML(c, http.StatusOK, "admin/pages/edit.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"errors": []string{err.Error()}, "page": page})))
+		return
+	}
+
+	if !updated {
+		// Someone else saved the page after the form was opened
+		current, err := a.Pages.Find(c.Request.Context(), page.ID)
+		if err != nil {
+			if wantsJSON(c) {
+				c.JSON(http.StatusNotFound, gin.H{"error": tr(c, "Page not found")})
+				return
+			}
+			renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Page not found")}}))
+			return
+		}
+
+		if wantsJSON(c) {
+			c.JSON(http.StatusConflict, gin.H{"error": tr(c, "Page was changed by someone else"), "current": current})
+			return
+		}
+
+		// Saving the form again overwrites the current version
+		page.Version = current.Version
+		renderHTML(c, http.StatusConflict, "admin/pages/edit.html", addFlashesAndUser(c, a.pageFormData(c, &gin.H{"page": page, "conflict": pageConflict(a.pageWithRelations(c, page), a.pageWithRelations(c, current))})))
+		return
+	}
+
+	a.audit(c, "update", "page", page.ID, before, page)
+
+	a.invalidateSEOCache()
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, page)
 		return
 	}
 
 	session := sessions.Default(c)
-	session.AddFlash("Page was edited.")
+	session.AddFlash(tr(c, "Page was edited."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/pages")
 }
 
-func actionAdminPagesDestroy(c *gin.Context) {
-	id := c.Param("id")
-	if err := db.Delete(&Page{}, id).Error; err != nil {
+// actionAdminPagesDestroy moves page to trash
+func (a *App) actionAdminPagesDestroy(c *gin.Context) {
+	page, err := a.Pages.Find(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		session := sessions.Default(c)
+		session.AddFlash(tr(c, "Page not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/pages")
+		return
+	}
+
+	if err := a.Pages.Delete(c.Request.Context(), &page); err != nil {
 		session := sessions.Default(c)
 		session.AddFlash(err.Error())
 		session.Save()
@@ -368,112 +624,60 @@ func actionAdminPagesDestroy(c *gin.Context) {
 		return
 	}
 
+	a.audit(c, "delete", "page", page.ID, page, nil)
+
+	a.invalidateSEOCache()
+
 	session := sessions.Default(c)
-	session.AddFlash("Page was deleted.")
+	session.AddFlash(tr(c, "Page was deleted. It can be restored from trash."))
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/admin/pages")
 }
 
-func actionPublicTools(c *gin.Context) {
-	c.HTML(http.StatusOK, "public/tools.html", addFlashesAndUser(c, &gin.H{}))
+func (a *App) actionPublicTools(c *gin.Context) {
+	// q and write prefill SQL console, e.g. from history
+	a.renderTools(c, http.StatusOK, gin.H{"q": c.Query("q"), "write": c.Query("write") != ""})
 }
 
-func actionPublicToolsDBClear(c *gin.Context) {
+func (a *App) actionPublicToolsDBClear(c *gin.Context) {
 	session := sessions.Default(c)
 
-	// Clear all users and pages from the database
-	if err := db.Exec("delete from \"user\"").Error; err != nil {
-		session.AddFlash("Error clearing users: " + err.Error())
+	if err := clearDB(a.requestDB(c)); err != nil {
+		session.AddFlash("Error " + err.Error())
 	} else {
-		if err := db.Exec("delete from \"page\"").Error; err != nil {
-			session.AddFlash("Error clearing pages: " + err.Error())
-		} else {
-			session.AddFlash("Database cleared successfully.")
-		}
+		session.AddFlash("Database cleared successfully.")
 	}
 
+	a.audit(c, "tools.db_clear", "", 0, nil, nil)
+
+	a.invalidateSEOCache()
+
 	session.Save()
 
 	c.Redirect(http.StatusSeeOther, "/tools")
 }
 
-func actionPublicToolsSeed(c *gin.Context) {
+func (a *App) actionPublicToolsSeed(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	session := sessions.Default(c)
 
-	result := db.Create(&User{Login: "admin", Password: "admin"})
-	if result.Error != nil {
-		session.AddFlash("Error seeding database: " + result.Error.Error())
+	if err := a.Users.Create(ctx, &User{Login: "admin", Password: "admin"}); err != nil {
+		session.AddFlash("Error seeding database: " + err.Error())
 	} else {
-		result = db.Create(&Page{Slug: "about", Content: "This is the about page."})
-		if result.Error != nil {
-			session.AddFlash("Error seeding database: " + result.Error.Error())
+		if err := a.Pages.Create(ctx, &Page{Slug: "about", Content: "This is the about page."}, nil); err != nil {
+			session.AddFlash("Error seeding database: " + err.Error())
 		} else {
 			session.AddFlash("Database seeded successfully.")
 		}
 	}
 
-	session.Save()
-
-	c.Redirect(http.StatusSeeOther, "/tools")
-}
-
-func actionPublicToolsSQL(c *gin.Context) {
-	// Get SQL query from URL parameter
-	q := c.Query("q")
-	if q == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'q' parameter"})
-		return
-	}
-
-	sqlDB, err := db.DB()
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting DB: " + err.Error()})
-		return
-	}
-
-	rows, err := sqlDB.Query(q)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error executing SQL query: " + err.Error()})
-		return
-	}
-
-	cols, err := rows.Columns()
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving columns: " + err.Error()})
-		return
-	}
-
-	out := make([]map[string]interface{}, 0)
-
-	for rows.Next() {
-		// Create a slice of interface{}'s to represent each column,
-		// and a second slice to contain pointers to each item in the columns slice.
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i, _ := range columns {
-			columnPointers[i] = &columns[i]
-		}
-
-		// Scan the result into the column pointers...
-		if err := rows.Scan(columnPointers...); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err})
-			return
-		}
+	a.audit(c, "tools.seed", "", 0, nil, nil)
 
-		// Create our map, and retrieve the value for each column from the pointers slice,
-		// storing it in the map with the name of the column as the key.
-		m := make(map[string]interface{})
-		for i, colName := range cols {
-			val := columnPointers[i].(*interface{})
-			m[colName] = *val
-		}
+	a.invalidateSEOCache()
 
-		out = append(out, m)
-	}
+	session.Save()
 
-	c.JSON(http.StatusOK, gin.H{"q": q, "out": out})
+	c.Redirect(http.StatusSeeOther, "/tools")
 }
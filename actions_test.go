@@ -0,0 +1,927 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func userPath(user User, action string) string {
+	return "/admin/users/" + strconv.FormatUint(uint64(user.ID), 10) + action
+}
+
+func pagePath(page Page, action string) string {
+	return "/admin/pages/" + strconv.FormatUint(uint64(page.ID), 10) + action
+}
+
+func TestPublicRoot(t *testing.T) {
+	a := newTestApp(t)
+	createPage(t, a, Page{Slug: "about"})
+
+	w := newTestClient(t, a).get("/")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "about")
+}
+
+// Public and admin error pages show request ID, so that users can report it
+func TestErrorPagesShowRequestID(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	for _, path := range []string{"/tags/missing", "/admin/pages/999/translations"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Request-ID", "report-me-42")
+		w := tc.do(req)
+		assertStatus(t, w, http.StatusNotFound)
+		assertContains(t, w, "Request ID: <code>report-me-42</code>")
+	}
+}
+
+func TestPublicPage(t *testing.T) {
+	a := newTestApp(t)
+	createPage(t, a, Page{Slug: "about", Title: "About us", Content: "Hello there"}, "news")
+	tc := newTestClient(t, a)
+
+	w := tc.get("/pages/about")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "Hello there")
+	assertContains(t, w, "http://example.com/pages/about")
+
+	w = tc.get("/pages/missing")
+	assertStatus(t, w, http.StatusNotFound)
+	assertContains(t, w, "Page not found")
+}
+
+func TestLogin(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.get("/login"), http.StatusOK)
+
+	w := tc.post("/login", url.Values{"login": {"alice"}, "password": {"wrong"}})
+	assertStatus(t, w, http.StatusUnauthorized)
+	assertContains(t, w, "Invalid username or password")
+
+	w = tc.post("/login", url.Values{"login": {"alice"}, "password": {testPassword}})
+	assertRedirect(t, w, "/admin/users")
+	assertStatus(t, tc.follow(w), http.StatusOK)
+
+	var count int64
+	a.DB.Model(&AuditLog{}).Where("action IN ?", []string{"login", "login_failed"}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 login audit entries, got %d", count)
+	}
+}
+
+// Values of unauthenticated requests can't run as formulas in spreadsheet opening the export
+func TestAuditExportEscapesFormulas(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"login": {"=1+1"}, "password": {"x"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", `=HYPERLINK("http://evil.example","x")`)
+	assertStatus(t, newTestClient(t, a).do(req), http.StatusUnauthorized)
+
+	w := tc.get("/admin/audit/export?action=login_failed")
+	assertStatus(t, w, http.StatusOK)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected header and one entry, got %q", records)
+	}
+	if got := records[1][len(records[1])-1]; got != `'=HYPERLINK("http://evil.example","x")` {
+		t.Fatalf("expected user agent to be escaped, got %q", got)
+	}
+
+	for value, want := range map[string]string{
+		"=cmd|' /C calc'!A0": "'=cmd|' /C calc'!A0",
+		"+1":                 "'+1",
+		"-1":                 "'-1",
+		"@SUM(A1)":           "'@SUM(A1)",
+		"\t=1":               "'\t=1",
+		"\r=1":               "'\r=1",
+		"login: =1":          "login: =1",
+		"":                   "",
+	} {
+		if got := csvSafeCell(value); got != want {
+			t.Errorf("%q: expected %q, got %q", value, want, got)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	w := tc.get("/logout")
+	assertRedirect(t, w, "/admin/users")
+	assertRedirect(t, tc.follow(w), "/login")
+
+	// Only logouts of signed in users are counted
+	assertRedirect(t, tc.get("/logout"), "/admin/users")
+	assertContains(t, tc.get("/metrics"), "app_logouts_total 1\n")
+}
+
+func TestAdminRequiresLogin(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	for _, path := range []string{"/admin/users", "/admin/pages", "/admin/users/new", "/admin/pages/new"} {
+		assertRedirect(t, tc.get(path), "/login")
+	}
+	assertRedirect(t, tc.post("/admin/users/create", url.Values{"login": {"bob"}, "password": {"secret"}}), "/login")
+}
+
+func TestAdminIndex(t *testing.T) {
+	a := newTestApp(t)
+	assertRedirect(t, newTestClient(t, a).get("/admin"), "/admin/users")
+}
+
+func TestAdminUsersIndexAndShow(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	w := tc.get("/admin/users")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "bob")
+
+	w = tc.get(userPath(bob, ""))
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "bob")
+
+	w = tc.get("/admin/users/999")
+	assertStatus(t, w, http.StatusNotFound)
+	assertContains(t, w, "User not found")
+
+	assertStatus(t, tc.get("/admin/users/abc"), http.StatusNotFound)
+}
+
+func TestAdminUsersCreate(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertStatus(t, tc.get("/admin/users/new"), http.StatusOK)
+
+	w := tc.post("/admin/users/create", url.Values{"login": {"bo"}, "password": {""}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Login: Field is too short")
+	assertContains(t, w, "Password: Field is required")
+
+	w = tc.post("/admin/users/create", url.Values{"login": {"bob"}, "password": {"secret"}})
+	assertRedirect(t, w, "/admin/users")
+	assertContains(t, tc.follow(w), "User was added.")
+
+	if _, err := a.Users.FindByCredentials(context.Background(), "bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Login is unique
+	w = tc.post("/admin/users/create", url.Values{"login": {"bob"}, "password": {"secret"}})
+	assertStatus(t, w, http.StatusInternalServerError)
+}
+
+func TestAdminUsersLoginReusableAfterDelete(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	assertRedirect(t, tc.post(userPath(bob, "/delete"), nil), "/admin/users")
+	assertRedirect(t, tc.post("/admin/users/create", url.Values{"login": {"bob"}, "password": {"secret"}}), "/admin/users")
+
+	// Trashed user can't be restored while its login is used
+	w := tc.post("/admin/trash/users/"+strconv.FormatUint(uint64(bob.ID), 10)+"/restore", nil)
+	assertContains(t, tc.follow(w), "login bob is already used")
+}
+
+func TestAdminUsersEdit(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	w := tc.get(userPath(bob, "/edit"))
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "bob")
+
+	assertStatus(t, tc.get("/admin/users/999/edit"), http.StatusNotFound)
+}
+
+func TestAdminUsersUpdate(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	w := tc.post(userPath(bob, "/update"), url.Values{"login": {"b"}, "password": {"secret"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "Login: Field is too short")
+
+	w = tc.post(userPath(bob, "/update"), url.Values{"login": {"robert"}, "password": {"secret"}, "version": {"1"}})
+	assertRedirect(t, w, "/admin/users")
+	assertContains(t, tc.follow(w), "User was edited.")
+
+	updated, err := a.Users.Find(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Login != "robert" || updated.Version != 2 {
+		t.Fatalf("unexpected user after update: %+v", updated)
+	}
+
+	// Form opened before the update above
+	w = tc.post(userPath(bob, "/update"), url.Values{"login": {"bobby"}, "password": {"secret"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusConflict)
+	assertContains(t, w, "Conflict")
+
+	w = tc.post("/admin/users/999/update", url.Values{"login": {"bobby"}, "password": {"secret"}})
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestAdminUsersUpdateJSON(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	w := tc.postJSON(userPath(bob, "/update"), url.Values{"login": {""}, "password": {"secret"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Login: Field is required")
+
+	w = tc.postJSON(userPath(bob, "/update"), url.Values{"login": {"robert"}, "password": {"secret"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	var user User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Login != "robert" {
+		t.Fatalf("expected updated user, got %+v", user)
+	}
+
+	w = tc.postJSON(userPath(bob, "/update"), url.Values{"login": {"bobby"}, "password": {"secret"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusConflict)
+	assertContains(t, w, "changed by someone else")
+
+	assertStatus(t, tc.postJSON("/admin/users/999/update", url.Values{}), http.StatusNotFound)
+}
+
+func TestAdminUsersDestroy(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+
+	w := tc.post(userPath(bob, "/delete"), nil)
+	assertRedirect(t, w, "/admin/users")
+	assertContains(t, tc.follow(w), "User was deleted. It can be restored from trash.")
+
+	if _, err := a.Users.FindTrashed(context.Background(), bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w = tc.post(userPath(bob, "/delete"), nil)
+	assertRedirect(t, w, "/admin/users")
+	assertContains(t, tc.follow(w), "User not found")
+}
+
+func TestAdminPagesIndexAndShow(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about"}, "company")
+	createPage(t, a, Page{Slug: "contacts"})
+
+	w := tc.get("/admin/pages")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "about")
+	assertContains(t, w, "contacts")
+
+	w = tc.get("/admin/pages?tag=company")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "about")
+
+	w = tc.get(pagePath(about, ""))
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "company")
+
+	w = tc.get("/admin/pages/999")
+	assertStatus(t, w, http.StatusNotFound)
+	assertContains(t, w, "Page not found")
+}
+
+func TestAdminPagesCreate(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertStatus(t, tc.get("/admin/pages/new"), http.StatusOK)
+
+	w := tc.post("/admin/pages/create", url.Values{
+		"slug":          {""},
+		"content":       {""},
+		"canonical_url": {"not a url"},
+		"og_image_id":   {"999"},
+		"category_id":   {"999"},
+		"tags":          {"ok, bad!tag"},
+	})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Slug: Field is required")
+	assertContains(t, w, "Content: Field is required")
+	assertContains(t, w, "CanonicalURL: Invalid URL")
+	assertContains(t, w, "OGImageID: Invalid input")
+	assertContains(t, w, "CategoryID: Invalid input")
+	assertContains(t, w, "Invalid tag")
+
+	w = tc.post("/admin/pages/create", url.Values{"slug": {"about"}, "content": {"About us"}, "tags": {"Company, news"}})
+	assertRedirect(t, w, "/admin/pages")
+	assertContains(t, tc.follow(w), "Page was added.")
+
+	page, err := a.Pages.FindBySlug(context.Background(), "about")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TagNames() != "company, news" {
+		t.Fatalf("unexpected tags: %q", page.TagNames())
+	}
+
+	// Slug is unique
+	w = tc.post("/admin/pages/create", url.Values{"slug": {"about"}, "content": {"Again"}})
+	assertStatus(t, w, http.StatusInternalServerError)
+}
+
+func TestAdminPagesEdit(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about"})
+
+	w := tc.get(pagePath(about, "/edit"))
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "about")
+
+	assertStatus(t, tc.get("/admin/pages/999/edit"), http.StatusNotFound)
+}
+
+func TestAdminPagesUpdate(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about", Content: "Old"}, "old")
+
+	w := tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {""}, "version": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "Content: Field is required")
+
+	w = tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"New"}, "tags": {"new"}, "version": {"1"}})
+	assertRedirect(t, w, "/admin/pages")
+	assertContains(t, tc.follow(w), "Page was edited.")
+
+	page, err := a.Pages.Find(context.Background(), about.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Content != "New" || page.TagNames() != "new" || page.Version != 2 {
+		t.Fatalf("unexpected page after update: %+v", page)
+	}
+
+	// Form opened before the update above
+	w = tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"Mine"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusConflict)
+	assertContains(t, w, "Conflict")
+
+	assertStatus(t, tc.post("/admin/pages/999/update", url.Values{"slug": {"x"}, "content": {"x"}}), http.StatusNotFound)
+}
+
+func TestAdminPagesUpdateJSON(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about"})
+
+	w := tc.postJSON(pagePath(about, "/update"), url.Values{"slug": {""}, "content": {"x"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Slug: Field is required")
+
+	w = tc.postJSON(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"New"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"content":"New"`)
+
+	w = tc.postJSON(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"Mine"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusConflict)
+	assertContains(t, w, "changed by someone else")
+
+	assertStatus(t, tc.postJSON("/admin/pages/999/update", url.Values{}), http.StatusNotFound)
+}
+
+func TestAdminPagesDestroy(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about"})
+
+	w := tc.post(pagePath(about, "/delete"), nil)
+	assertRedirect(t, w, "/admin/pages")
+	assertContains(t, tc.follow(w), "Page was deleted. It can be restored from trash.")
+
+	assertStatus(t, tc.get("/pages/about"), http.StatusNotFound)
+
+	w = tc.post(pagePath(about, "/delete"), nil)
+	assertRedirect(t, w, "/admin/pages")
+	assertContains(t, tc.follow(w), "Page not found")
+}
+
+func TestToolsDisabledOutsideTests(t *testing.T) {
+	a := newTestApp(t)
+	a.Config.Test = false
+
+	assertStatus(t, newTestClient(t, a).get("/tools"), http.StatusNotFound)
+}
+
+func TestTools(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.get("/tools"), http.StatusOK)
+
+	w := tc.get("/tools/seed")
+	assertRedirect(t, w, "/tools")
+	assertContains(t, tc.follow(w), "Database seeded successfully.")
+
+	// Seed user already exists
+	w = tc.get("/tools/seed")
+	assertContains(t, tc.follow(w), "Error seeding database")
+
+	w = tc.get("/tools/db-clear")
+	assertRedirect(t, w, "/tools")
+	assertContains(t, tc.follow(w), "Database cleared successfully.")
+
+	if count, _ := a.Users.Count(context.Background()); count != 0 {
+		t.Fatalf("expected no users after clear, got %d", count)
+	}
+}
+
+func TestToolsSQL(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.get("/tools/sql"), http.StatusBadRequest)
+
+	w := tc.getJSON("/tools/sql?q=" + url.QueryEscape("select login from "+a.DB.Statement.Quote("user")))
+	assertStatus(t, w, http.StatusOK)
+	var result struct {
+		Out []map[string]interface{} `json:"out"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Out) != 1 || result.Out[0]["login"] != "alice" {
+		t.Fatalf("unexpected result: %s", w.Body.String())
+	}
+
+	w = tc.getJSON("/tools/sql?q=" + url.QueryEscape("select from nowhere"))
+	assertStatus(t, w, http.StatusInternalServerError)
+	assertContains(t, w, "Error executing SQL query")
+}
+
+func TestToolsSQLReadOnly(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+	del := "delete from " + a.DB.Statement.Quote("user")
+
+	w := tc.get("/tools/sql?q=" + url.QueryEscape(del))
+	assertStatus(t, w, http.StatusInternalServerError)
+	assertContains(t, w, "Error executing SQL query")
+
+	assertStatus(t, tc.get("/tools/sql?write=1&q="+url.QueryEscape(del)), http.StatusBadRequest)
+
+	// Statement leaving read-only mode can't be followed by a write
+	escape := "PRAGMA query_only = OFF; " + del + "; COMMIT; select count(*) from " + a.DB.Statement.Quote("user")
+	w = tc.get("/tools/sql?q=" + url.QueryEscape(escape))
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "read-only mode runs one statement at a time")
+
+	if taken, err := a.Users.LoginTaken(context.Background(), "alice"); err != nil || !taken {
+		t.Fatalf("read-only query deleted user: %v", err)
+	}
+
+	assertStatus(t, tc.post("/tools/sql", url.Values{"q": {del}, "write": {"1"}}), http.StatusOK)
+	if taken, err := a.Users.LoginTaken(context.Background(), "alice"); err != nil || taken {
+		t.Fatalf("write query didn't delete user: %v", err)
+	}
+}
+
+func TestSQLStatementCount(t *testing.T) {
+	for _, tt := range []struct {
+		dialect, q string
+		want       int
+	}{
+		{"sqlite", "select 1", 1},
+		{"sqlite", " select 1;\n-- done\n", 1},
+		{"sqlite", "select ';', \"a;b\", `c;d` /* ; */ -- ;", 1},
+		{"sqlite", "select 'it''s; fine'", 1},
+		{"sqlite", "select 'a\\'; delete from x", 2},
+		{"sqlite", "PRAGMA query_only = OFF; DELETE FROM x; COMMIT; SELECT count(*) FROM x", 4},
+		{"sqlite", ";;", 0},
+		{"mysql", "select 'a\\'; delete from x'", 1},
+		{"mysql", "select 1--1; delete from x", 2},
+		{"mysql", "select 1 # ; delete", 1},
+		{"postgres", "select $$;$$, $tag$ ; $tag$", 1},
+		{"postgres", "select E'a\\'; b'", 1},
+		{"postgres", "select 'a\\'; delete from x", 2},
+		{"postgres", "select $1; delete from x", 2},
+	} {
+		if got := sqlStatementCount(tt.dialect, tt.q); got != tt.want {
+			t.Errorf("%s %q: expected %d statements, got %d", tt.dialect, tt.q, tt.want, got)
+		}
+	}
+}
+
+func TestToolsSQLResult(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	createUser(t, a, "bob")
+	a.Config.SQLConsoleMaxRows = 1
+	tc := newTestClient(t, a)
+	q := "select id, login from " + a.DB.Statement.Quote("user") + " order by login"
+
+	w := tc.getJSON("/tools/sql?q=" + url.QueryEscape(q))
+	assertStatus(t, w, http.StatusOK)
+	var result struct {
+		Columns []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+		Out       []map[string]interface{} `json:"out"`
+		Truncated bool                     `json:"truncated"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Columns) != 2 || result.Columns[1].Name != "login" || result.Columns[1].Type == "" {
+		t.Fatalf("unexpected columns: %s", w.Body.String())
+	}
+	if len(result.Out) != 1 || result.Out[0]["login"] != "alice" || !result.Truncated {
+		t.Fatalf("expected one row and truncated result: %s", w.Body.String())
+	}
+
+	w = tc.get("/tools/sql?format=csv&q=" + url.QueryEscape(q))
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "id,login\n")
+	assertContains(t, w, ",alice\n")
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="query.csv"` {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	// Values read from database can't run as formulas in spreadsheets
+	w = tc.get("/tools/sql?format=csv&q=" + url.QueryEscape(`select '=HYPERLINK("http://evil.example","x")' as "@link"`))
+	assertStatus(t, w, http.StatusOK)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0][0] != "'@link" || records[1][0] != `'=HYPERLINK("http://evil.example","x")` {
+		t.Fatalf("expected escaped cells, got %q", records)
+	}
+}
+
+func TestToolsSQLHistory(t *testing.T) {
+	a := newTestApp(t)
+	alice := loginAs(t, a, createUser(t, a, "alice"))
+	bob := loginAs(t, a, createUser(t, a, "bob"))
+
+	assertStatus(t, alice.get("/tools/sql?q="+url.QueryEscape("select 1")), http.StatusOK)
+	assertStatus(t, alice.get("/tools/sql?q="+url.QueryEscape("select from nowhere")), http.StatusInternalServerError)
+
+	var history struct {
+		History []SQLQuery `json:"history"`
+	}
+	w := alice.get("/tools/sql/history")
+	assertStatus(t, w, http.StatusOK)
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.History) != 2 || history.History[0].Error == "" || history.History[1].Query != "select 1" || history.History[1].RowCount != 1 {
+		t.Fatalf("unexpected history: %s", w.Body.String())
+	}
+
+	w = bob.get("/tools/sql/history")
+	assertStatus(t, w, http.StatusOK)
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.History) != 0 {
+		t.Fatalf("history of other user is shown: %s", w.Body.String())
+	}
+}
+
+func TestToolsSQLHTML(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+	user := a.DB.Statement.Quote("user")
+
+	w := tc.post("/tools/sql", url.Values{"q": {"select login, deleted_at, '{\"a\":1}' as doc from " + user}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<th>login")
+	assertContains(t, w, "<td>alice</td>")
+	assertContains(t, w, "<em><small>NULL</small></em>")
+	assertContains(t, w, "<pre>{\n  &#34;a&#34;: 1\n}</pre>")
+	assertContains(t, w, "1 row(s)")
+	assertContains(t, w, "re-run")
+
+	w = tc.post("/tools/sql", url.Values{"q": {"select from nowhere"}})
+	assertStatus(t, w, http.StatusInternalServerError)
+	assertContains(t, w, "Error executing SQL query")
+
+	w = tc.post("/tools/sql", url.Values{"q": {"select login from " + user}, "explain": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "EXPLAIN")
+}
+
+func TestToolsSQLSaved(t *testing.T) {
+	a := newTestApp(t)
+	alice := loginAs(t, a, createUser(t, a, "alice"))
+	bob := loginAs(t, a, createUser(t, a, "bob"))
+
+	w := alice.post("/tools/sql/saved", url.Values{"name": {"ones"}, "q": {"select 1"}})
+	assertRedirect(t, w, "/tools")
+	w = alice.follow(w)
+	assertContains(t, w, "Query was saved.")
+	assertContains(t, w, "<td>ones</td>")
+	assertContains(t, w, `href="/tools/sql?q=select%201"`)
+
+	assertContains(t, alice.follow(alice.post("/tools/sql/saved", url.Values{"q": {"select 1"}})), "Query and its name are required.")
+
+	var saved SavedSQLQuery
+	if err := a.DB.First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := "/tools/sql/saved/" + strconv.Itoa(int(saved.ID)) + "/delete"
+
+	assertContains(t, bob.follow(bob.post(path, nil)), "Saved query not found")
+	assertContains(t, alice.follow(alice.post(path, nil)), "Saved query was deleted.")
+}
+
+func TestToolsFixtures(t *testing.T) {
+	a := newTestApp(t)
+	createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+
+	w := tc.get("/tools/fixtures")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"basic"`)
+
+	assertStatus(t, tc.post("/tools/fixtures/missing", nil), http.StatusNotFound)
+
+	w = tc.post("/tools/fixtures/basic?reset=1", nil)
+	assertStatus(t, w, http.StatusOK)
+	var result struct {
+		IDs FixtureIDs `json:"ids"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.IDs.Users) != 2 || result.IDs.Categories["local-news"] == 0 || result.IDs.Pages["hello"] == 0 {
+		t.Fatalf("unexpected ids: %s", w.Body.String())
+	}
+
+	page, err := a.Pages.Find(context.Background(), result.IDs.Pages["hello"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.CategoryID == nil || *page.CategoryID != result.IDs.Categories["local-news"] || page.TagNames() != "news, welcome" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if count, _ := a.Users.Count(context.Background()); count != 2 {
+		t.Fatalf("expected users to be reset, got %d", count)
+	}
+
+	// Users exist already, nothing is loaded
+	w = tc.post("/tools/fixtures/basic", nil)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+	if count, _ := a.Users.Count(context.Background()); count != 2 {
+		t.Fatalf("expected failed load to be rolled back, got %d users", count)
+	}
+}
+
+// Reset and load happen in one transaction, failed load keeps the database as it was
+func TestToolsFixturesResetRollsBack(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.FixturesDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(cfg.FixturesDir, "broken.yaml"), []byte("users:\n  - login: bob\n  - login: bob\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newApp(cfg, openTestDB(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, a, "alice")
+	createPage(t, a, Page{Slug: "about"})
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.post("/tools/fixtures/broken?reset=1", nil), http.StatusUnprocessableEntity)
+	if count, _ := a.Users.Count(context.Background()); count != 1 {
+		t.Fatalf("expected reset to be rolled back, got %d users", count)
+	}
+	if _, err := a.Pages.FindBySlug(context.Background(), "about"); err != nil {
+		t.Fatalf("expected page to be kept: %v", err)
+	}
+}
+
+// Media records are cleared like other records included in snapshots
+func TestToolsDBClearMedia(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	assertRedirect(t, uploadMedia(tc, "photo.png", testPNG(t, 4, 4)), "/admin/media")
+
+	assertRedirect(t, tc.get("/tools/db-clear"), "/tools")
+	var count int64
+	a.DB.Model(&Media{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected media to be cleared, got %d", count)
+	}
+}
+
+func TestToolsSnapshots(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+	alice := createUser(t, a, "alice")
+	createPage(t, a, Page{Slug: "about"}, "info")
+
+	assertStatus(t, tc.post("/tools/snapshots/bad%20name", nil), http.StatusBadRequest)
+	assertStatus(t, tc.post("/tools/snapshots/base", nil), http.StatusOK)
+
+	assertRedirect(t, tc.get("/tools/db-clear"), "/tools")
+	createUser(t, a, "bob")
+
+	assertStatus(t, tc.post("/tools/snapshots/missing/restore", nil), http.StatusNotFound)
+	assertStatus(t, tc.post("/tools/snapshots/base/restore", nil), http.StatusOK)
+
+	users, err := a.Users.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != alice.ID || users[0].Login != "alice" {
+		t.Fatalf("unexpected users after restore: %+v", users)
+	}
+	pages, err := a.Pages.List(context.Background(), PageFilter{Tag: "info"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Slug != "about" {
+		t.Fatalf("unexpected pages after restore: %+v", pages)
+	}
+
+	// IDs continue after restored records
+	if carol := createUser(t, a, "carol"); carol.ID <= alice.ID {
+		t.Fatalf("expected new ID after %d, got %d", alice.ID, carol.ID)
+	}
+
+	assertContains(t, tc.get("/tools/fixtures"), `"snapshots":["base"]`)
+	assertStatus(t, tc.post("/tools/snapshots/base/delete", nil), http.StatusOK)
+	assertStatus(t, tc.post("/tools/snapshots/base/delete", nil), http.StatusNotFound)
+}
+
+func TestToolsLoginAs(t *testing.T) {
+	a := newTestApp(t)
+	alice := createUser(t, a, "alice")
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.post("/tools/login-as", url.Values{"login": {"nobody"}}), http.StatusNotFound)
+
+	assertRedirect(t, tc.post("/tools/login-as", url.Values{"login": {"alice"}, "redirect": {"//example.com"}}), "/admin/users")
+	assertContains(t, tc.get("/admin/users"), "alice")
+
+	tc = newTestClient(t, a)
+	assertRedirect(t, tc.post("/tools/login-as", url.Values{"id": {strconv.Itoa(int(alice.ID))}, "redirect": {"/admin/pages"}}), "/admin/pages")
+	assertStatus(t, tc.get("/admin/pages"), http.StatusOK)
+}
+
+func TestToolsClock(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	assertStatus(t, tc.post("/tools/clock/freeze", url.Values{"time": {"yesterday"}}), http.StatusBadRequest)
+	w := tc.post("/tools/clock/freeze", url.Values{"time": {"2020-01-02T03:04:05Z"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"frozen":true`)
+
+	user := createUser(t, a, "alice")
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !user.CreatedAt.Equal(want) {
+		t.Fatalf("expected user created at %s, got %s", want, user.CreatedAt)
+	}
+
+	if err := a.Users.Delete(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, tc.post("/tools/clock/advance", url.Values{"by": {(trashDefaultRetention + time.Hour).String()}}), http.StatusOK)
+	if !a.now().Equal(time.Date(2020, 2, 1, 4, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected time after advance: %s", a.now())
+	}
+	if err := a.purgeTrash(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Users.FindTrashed(context.Background(), user.ID); err == nil {
+		t.Fatal("expected trash to be purged after retention")
+	}
+
+	w = tc.post("/tools/clock/reset", nil)
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"frozen":false`)
+	if time.Since(a.now()) > time.Minute {
+		t.Fatalf("expected system time after reset, got %s", a.now())
+	}
+}
+
+// Sign in expires by clock of app, not wall time
+func TestSessionExpiresByClock(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertStatus(t, tc.post("/tools/clock/advance", url.Values{"by": {(sessionDefaultLifetime - time.Hour).String()}}), http.StatusOK)
+	assertStatus(t, tc.get("/admin/users"), http.StatusOK)
+
+	assertStatus(t, tc.post("/tools/clock/advance", url.Values{"by": {"2h"}}), http.StatusOK)
+	assertRedirect(t, tc.get("/admin/users"), "/login")
+
+	// Expired sign in is forgotten, moving clock back doesn't restore it
+	assertStatus(t, tc.post("/tools/clock/reset", nil), http.StatusOK)
+	assertRedirect(t, tc.get("/admin/users"), "/login")
+
+	assertRedirect(t, tc.post("/login", url.Values{"login": {"admin"}, "password": {testPassword}}), "/admin/users")
+	assertStatus(t, tc.get("/admin/users"), http.StatusOK)
+}
+
+// Clock of app is not leaked into db shared with another app
+func TestToolsClockKeepsDBUntouched(t *testing.T) {
+	cfg := testConfig(t)
+	db := openTestDB(t, cfg)
+	frozen, err := newApp(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newApp(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moment := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	frozen.Clock.(*testClock).Freeze(moment)
+
+	if user := createUser(t, frozen, "alice"); !user.CreatedAt.Equal(moment) {
+		t.Fatalf("expected user created at %s, got %s", moment, user.CreatedAt)
+	}
+	if user := createUser(t, other, "bob"); time.Since(user.CreatedAt) > time.Minute {
+		t.Fatalf("expected user created now, got %s", user.CreatedAt)
+	}
+	if now := db.Config.NowFunc(); time.Since(now) > time.Minute {
+		t.Fatalf("expected shared db to keep system time, got %s", now)
+	}
+}
+
+func TestToolsMail(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.NotifyEmails = []string{"alice@example.com", "bob@example.com"}
+	a, err := newApp(cfg, openTestDB(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := loginAsAdmin(t, a)
+
+	assertContains(t, tc.get("/tools/mail"), `"mail":[]`)
+
+	assertRedirect(t, tc.post("/admin/users/create", url.Values{"login": {"carol"}, "password": {"secret"}}), "/admin/users")
+
+	w := tc.get("/tools/mail")
+	assertStatus(t, w, http.StatusOK)
+	var resp struct {
+		Mail []Mail `json:"mail"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Mail) != 1 {
+		t.Fatalf("expected 1 mail, got %+v", resp.Mail)
+	}
+	if mail := resp.Mail[0]; strings.Join(mail.To, ",") != "alice@example.com,bob@example.com" || mail.Subject != "New user: carol" || !strings.Contains(mail.Body, "by admin") {
+		t.Fatalf("unexpected mail: %+v", mail)
+	}
+
+	assertStatus(t, tc.post("/tools/mail/clear", nil), http.StatusOK)
+	assertContains(t, tc.get("/tools/mail"), `"mail":[]`)
+}
+
+// Nobody is notified without NOTIFY_EMAIL
+func TestNewUserWithoutNotifyEmails(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertRedirect(t, tc.post("/admin/users/create", url.Values{"login": {"carol"}, "password": {"secret"}}), "/admin/users")
+	if sent := a.outbox.Sent(); len(sent) != 0 {
+		t.Fatalf("expected no mail, got %+v", sent)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// App holds everything handlers need. Handlers are its methods, so several apps
+// (e.g. in parallel tests) can run in one process.
+type App struct {
+	Config Config
+	DB     *gorm.DB
+
+	Users UserRepository
+	Pages PageRepository
+
+	Storage  MediaStorage
+	Mailer   Mailer
+	Renderer render.HTMLRender
+	Clock    Clock
+
+	// Emails sent in test mode, nil otherwise
+	outbox *outboxMailer
+
+	// Logger of "app" component
+	Logger *slog.Logger
+	// Logger of "http" component
+	HTTPLogger *slog.Logger
+
+	metrics   *appMetrics
+	seo       *seoCache
+	snapshots *snapshotStore
+	assets    *assetStore
+	// Templates of each locale, set in dev mode
+	devTemplates map[string]*reloadingRender
+
+	startedAt time.Time
+	// Set when schema was once found up to date, so readiness probes don't inspect schema every time
+	migrationsCurrent atomic.Bool
+	// Set when shutdown starts, so that readiness probe stops routing traffic to the app
+	shuttingDown atomic.Bool
+}
+
+// Unique indexes that ignore trashed records, so that login or slug of deleted record can be reused
+var activeUniqueIndexes = []struct{ table, column, name string }{
+	{"user", "login", "idx_user_login"},
+	{"page", "slug", "idx_page_slug"},
+}
+
+// openDialector returns gorm dialector of driver
+func openDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "postgres":
+		return postgres.Open(dsn), nil
+	case "sqlite":
+		return sqlite.Open(dsn), nil
+	case "mysql":
+		return mysql.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", driver)
+}
+
+// openDB connects to database, registers tracing callbacks and migrates schema
+func openDB(cfg Config) (*gorm.DB, error) {
+	dialector, err := openDialector(cfg.DatabaseDriver, cfg.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: newGormLogger(newLogger(cfg, "db"), cfg.SlowQueryThreshold),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registerTracingCallbacks(db); err != nil {
+		return nil, err
+	}
+
+	if err := migrateDB(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrateDB creates and updates tables of migratedModels
+func migrateDB(db *gorm.DB) error {
+	if err := db.AutoMigrate(migratedModels...); err != nil {
+		return err
+	}
+
+	for _, index := range activeUniqueIndexes {
+		if err := createActiveUniqueIndex(db, index.table, index.column, index.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createActiveUniqueIndex creates unique index of column over records not in trash.
+// MySQL has no partial indexes, so there the index includes generated column which is NULL for trashed records.
+func createActiveUniqueIndex(db *gorm.DB, table, column, name string) error {
+	if db.Migrator().HasIndex(table, name) {
+		return nil
+	}
+
+	if db.Dialector.Name() != "mysql" {
+		return db.Exec("CREATE UNIQUE INDEX ? ON ? (?) WHERE deleted_at IS NULL", clause.Column{Name: name}, clause.Table{Name: table}, clause.Column{Name: column}).Error
+	}
+
+	active := column + "_active"
+	if !db.Migrator().HasColumn(table, active) {
+		if err := db.Exec("ALTER TABLE ? ADD COLUMN ? TINYINT AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL", clause.Table{Name: table}, clause.Column{Name: active}).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec("CREATE UNIQUE INDEX ? ON ? (?, ?)", clause.Column{Name: name}, clause.Table{Name: table}, clause.Column{Name: column}, clause.Column{Name: active}).Error
+}
+
+// newApp creates app using db. Repositories, storage, templates and metrics are set up from cfg
+// and can be replaced before calling Router.
+func newApp(cfg Config, db *gorm.DB) (*App, error) {
+	storage, err := newLocalMediaStorage(cfg.MediaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &App{
+		Config:     cfg,
+		Storage:    storage,
+		Logger:     newLogger(cfg, "app"),
+		HTTPLogger: newLogger(cfg, "http"),
+		seo:        newSEOCache(),
+		snapshots:  newSnapshotStore(),
+		startedAt:  time.Now(),
+	}
+	a.Mailer = newLogMailer(a.Logger)
+	a.Clock = systemClock{}
+	if cfg.Test {
+		a.outbox = newOutboxMailer(a.Mailer)
+		a.Mailer = a.outbox
+		a.Clock = &testClock{}
+	}
+	// Timestamps of records follow the app clock. Session keeps db itself untouched, it may be shared with other apps.
+	a.DB = db.Session(&gorm.Session{NowFunc: func() time.Time { return a.now().Local() }})
+	a.Users = newGormUserRepository(a.DB)
+	a.Pages = newGormPageRepository(a.DB)
+
+	if a.assets, err = newAssetStore(staticFS(cfg), cfg.DevMode); err != nil {
+		return nil, err
+	}
+
+	if !messages.Has(cfg.DefaultLocale) {
+		return nil, fmt.Errorf("default locale %q has no translations", cfg.DefaultLocale)
+	}
+
+	fm := template.FuncMap{
+		"isTest": func() bool { return cfg.Test },
+		"asset":  a.assets.Path,
+	}
+	if cfg.DevMode {
+		renders := localizedHTMLRender{}
+		a.devTemplates = map[string]*reloadingRender{}
+		for _, locale := range messages.Locales() {
+			templates, err := newReloadingRender(cfg.TemplatesDir, localeFuncs(fm, locale), a.Logger)
+			if err != nil {
+				a.closeTemplates()
+				return nil, err
+			}
+			a.devTemplates[locale] = templates
+			renders[locale] = templates
+		}
+		a.Renderer = tracingHTMLRender{renders}
+	} else {
+		a.Renderer = tracingHTMLRender{loadTemplates(templatesFS(), fm)}
+	}
+
+	if a.metrics, err = newAppMetrics(a.DB, a.now); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// now returns current time of app clock
+func (a *App) now() time.Time {
+	return a.Clock.Now()
+}
+
+// Router creates gin engine with all middlewares and routes of app. Paths may start with locale, e.g. "/ru/admin".
+func (a *App) Router() http.Handler {
+	router := gin.New()
+	router.Use(middlewareRequestID, middlewareTracing(), middlewareTracingWriter, a.middlewareLogRequest, a.middlewareMetrics, gin.CustomRecoveryWithWriter(io.Discard, a.recoverPanic))
+
+	store := cookie.NewStore([]byte("secret"))
+	router.Use(sessions.Sessions("mysession", store), a.middlewareLocale)
+
+	router.HTMLRender = a.Renderer
+
+	a.setupRoutes(router)
+
+	return localePrefixHandler{next: router}
+}
+
+// requestDB returns db bound to context of request, so that query logs contain request ID
+func (a *App) requestDB(c *gin.Context) *gorm.DB {
+	return a.DB.WithContext(c.Request.Context())
+}
+
+// seed creates sample user if there are no users
+func (a *App) seed(ctx context.Context) error {
+	count, err := a.Users.Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return a.Users.Create(ctx, &User{Login: "admin", Password: "admin"})
+	}
+	return nil
+}
+
+// closeTemplates stops watching templates of dev mode
+func (a *App) closeTemplates() {
+	for _, templates := range a.devTemplates {
+		templates.Close()
+	}
+}
+
+// Close stops watching templates and closes DB connection pool
+func (a *App) Close() {
+	a.closeTemplates()
+
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		a.Logger.Error("Failed to get DB", "error", err)
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		a.Logger.Error("Failed to close DB", "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Templates, static assets and message catalogs are built into the binary, DEV_MODE reads templates and static assets
+// from TEMPLATES_DIR and STATIC_DIR instead
+//
+//go:embed templates static locales
+var embeddedFiles embed.FS
+
+// Fingerprinted assets never change, so browsers may keep them for a year
+const assetCacheControl = "public, max-age=31536000, immutable"
+
+// templatesFS returns templates built into the binary, dev mode reads them from disk by reloadingRender
+func templatesFS() fs.FS {
+	sub, _ := fs.Sub(embeddedFiles, "templates")
+	return sub
+}
+
+// localesFS returns message catalogs built into the binary
+func localesFS() fs.FS {
+	sub, _ := fs.Sub(embeddedFiles, "locales")
+	return sub
+}
+
+// staticFS returns static assets of app, from disk in dev mode
+func staticFS(cfg Config) fs.FS {
+	if cfg.DevMode {
+		return os.DirFS(cfg.StaticDir)
+	}
+	sub, _ := fs.Sub(embeddedFiles, "static")
+	return sub
+}
+
+// assetStore serves static assets under /static. Names of assets include hash of content, e.g. css/simple.1a2b3c4d.css,
+// so they can be cached forever and change URL when content changes. In dev mode assets are served by plain names
+// and not cached, so that changes on disk show up on reload.
+type assetStore struct {
+	fsys fs.FS
+	dev  bool
+	// Fingerprinted name of each asset and the other way around
+	fingerprinted map[string]string
+	original      map[string]string
+}
+
+func newAssetStore(fsys fs.FS, dev bool) (*assetStore, error) {
+	s := &assetStore{fsys: fsys, dev: dev, fingerprinted: map[string]string{}, original: map[string]string{}}
+	if dev {
+		return s, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+		s.fingerprinted[name] = hashed
+		s.original[hashed] = name
+		return nil
+	})
+	return s, err
+}
+
+// Path returns URL of asset, used by "asset" template func. Unknown assets keep their name.
+func (s *assetStore) Path(name string) string {
+	if hashed, ok := s.fingerprinted[name]; ok {
+		return "/static/" + hashed
+	}
+	return "/static/" + name
+}
+
+// actionStatic serves asset by fingerprinted name with long cache, or by plain name without caching
+func (a *App) actionStatic(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	if original, ok := a.assets.original[name]; ok {
+		c.Header("Cache-Control", assetCacheControl)
+		name = original
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	if !fs.ValidPath(name) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if info, err := fs.Stat(a.assets.fsys, name); err != nil || info.IsDir() {
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	http.ServeFileFS(c.Writer, c.Request, a.assets.fsys, name)
+}
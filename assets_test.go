@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+func TestStaticAssets(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	w := tc.get("/login")
+	assertStatus(t, w, http.StatusOK)
+	href := regexp.MustCompile(`/static/css/simple\.[0-9a-f]{8}\.css`).FindString(w.Body.String())
+	if href == "" {
+		t.Fatalf("expected fingerprinted stylesheet in layout: %s", w.Body.String())
+	}
+
+	w = tc.get(href)
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "--accent")
+	if got := w.Header().Get("Cache-Control"); got != assetCacheControl {
+		t.Fatalf("expected long cache of fingerprinted asset, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Fatalf("unexpected Content-Type %q", got)
+	}
+
+	w = tc.get("/static/css/simple.css")
+	assertStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Fatalf("expected plain name not to be cached, got %q", got)
+	}
+
+	assertStatus(t, tc.get("/static/css/missing.css"), http.StatusNotFound)
+	assertStatus(t, tc.get("/static/../main.go"), http.StatusNotFound)
+}
+
+func TestDevModeReadsFromDisk(t *testing.T) {
+	templatesDir := copyDir(t, "templates")
+	staticDir := copyDir(t, "static")
+
+	cfg := testConfig(t)
+	cfg.DevMode = true
+	cfg.TemplatesDir = templatesDir
+	cfg.StaticDir = staticDir
+	a, err := newApp(cfg, openTestDB(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.closeTemplates)
+	tc := newTestClient(t, a)
+
+	assertContains(t, tc.get("/login"), `href="/static/css/simple.css"`)
+
+	writeFile(t, filepath.Join(templatesDir, "public", "login.html"), `{{define "content"}}Changed login{{end}}`)
+	eventually(t, func() bool { return strings.Contains(tc.get("/login").Body.String(), "Changed login") })
+
+	// Parse errors are shown instead of the page until template is fixed
+	writeFile(t, filepath.Join(templatesDir, "layouts", "public.html"), `{{template "content" .}`)
+	eventually(t, func() bool { return tc.get("/login").Code == http.StatusInternalServerError })
+	w := tc.get("/")
+	assertStatus(t, w, http.StatusInternalServerError)
+	assertContains(t, w, "Template error")
+	assertContains(t, w, "public.html")
+
+	writeFile(t, filepath.Join(templatesDir, "layouts", "public.html"), `<main>{{template "content" .}}</main>`)
+	eventually(t, func() bool { return tc.get("/login").Code == http.StatusOK })
+
+	// New templates are picked up
+	writeFile(t, filepath.Join(templatesDir, "public", "new.html"), `{{define "content"}}New{{end}}`)
+	eventually(t, func() bool {
+		_, ok := a.devTemplates[sourceLocale].Instance("public/new.html", nil).(render.HTML)
+		return ok
+	})
+
+	writeFile(t, filepath.Join(staticDir, "css", "simple.css"), "body { color: red }")
+	assertContains(t, tc.get("/static/css/simple.css"), "color: red")
+}
+
+// copyDir copies directory of repo to temp dir
+func copyDir(t *testing.T, dir string) string {
+	t.Helper()
+	dst := t.TempDir()
+	if err := os.CopyFS(dst, os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// eventually fails test if cond doesn't become true within 5 seconds
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met in time")
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Number of audit log entries per page of the viewer
+const auditPageSize = 100
+
+// Fields that are never written to audit log
+var auditRedactedFields = map[string]bool{"password": true}
+
+// Fields that change on every save and only add noise to diffs
+var auditIgnoredFields = map[string]bool{"updated_at": true, "version": true}
+
+// AuditLog is an append-only record of admin action
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActorID    *uint     `gorm:"index" json:"actor_id"`
+	ActorLogin string    `gorm:"size:80" json:"actor_login"`
+	Action     string    `gorm:"size:50;index" json:"action"`
+	TargetType string    `gorm:"size:50;index" json:"target_type"`
+	TargetID   *uint     `gorm:"index" json:"target_id"`
+	Changes    string    `json:"changes"`
+	Details    string    `json:"details"`
+	IP         string    `gorm:"size:45" json:"ip"`
+	UserAgent  string    `gorm:"size:500" json:"user_agent"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+var errAuditLogAppendOnly = errors.New("audit log is append-only")
+
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditLogAppendOnly
+}
+
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errAuditLogAppendOnly
+}
+
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type auditFieldChange struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// ChangeList returns changed fields sorted by name, as shown in audit log viewer
+func (a AuditLog) ChangeList() []auditFieldChange {
+	var changes map[string]auditChange
+	if a.Changes == "" || json.Unmarshal([]byte(a.Changes), &changes) != nil {
+		return nil
+	}
+
+	list := make([]auditFieldChange, 0, len(changes))
+	for name, change := range changes {
+		list = append(list, auditFieldChange{Name: name, Before: auditValue(change.Before), After: auditValue(change.After)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func auditValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// auditFields converts record into map of its JSON fields
+func auditFields(record interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if record == nil {
+		return fields
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+
+	// Associations (e.g. page tags) are recorded by name
+	for name, value := range fields {
+		items, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		names := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if object, ok := item.(map[string]interface{}); ok {
+				names = append(names, object["name"])
+			} else {
+				names = append(names, item)
+			}
+		}
+		fields[name] = names
+	}
+
+	return fields
+}
+
+// auditDiff returns JSON with fields that differ between before and after. Redacted fields are marked as changed without values.
+func auditDiff(before, after interface{}) string {
+	b := auditFields(before)
+	a := auditFields(after)
+
+	changes := map[string]auditChange{}
+	for _, fields := range []map[string]interface{}{b, a} {
+		for name := range fields {
+			if auditIgnoredFields[name] || reflect.DeepEqual(b[name], a[name]) {
+				continue
+			}
+			if auditRedactedFields[name] {
+				changes[name] = auditChange{Before: "[REDACTED]", After: "[REDACTED]"}
+				continue
+			}
+			changes[name] = auditChange{Before: b[name], After: a[name]}
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(changes)
+	return string(data)
+}
+
+// audit appends entry to audit log. Actor is taken from currentUser. Failures are logged and don't break the action.
+func (a *App) audit(c *gin.Context, action, targetType string, targetID uint, before, after interface{}) {
+	a.auditDetails(c, action, targetType, targetID, before, after, "")
+}
+
+// auditDetails is audit with free-form details, e.g. executed SQL or attempted login
+func (a *App) auditDetails(c *gin.Context, action, targetType string, targetID uint, before, after interface{}, details string) {
+	db := a.requestDB(c)
+
+	entry := AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		Changes:    auditDiff(before, after),
+		Details:    details,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+
+	if targetID != 0 {
+		entry.TargetID = &targetID
+	}
+
+	if user, exists := c.Get("currentUser"); exists {
+		actor := user.(User)
+		entry.ActorID = &actor.ID
+		entry.ActorLogin = actor.Login
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		a.Logger.ErrorContext(c, "Failed to write audit log", "request_id", c.GetString("requestID"), "error", err)
+	}
+}
+
+// auditQuery applies filters of audit log viewer
+func (a *App) auditQuery(c *gin.Context) *gorm.DB {
+	db := a.requestDB(c)
+
+	query := db.Model(&AuditLog{})
+
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor_login = ?", actor)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if from, err := time.Parse("2006-01-02", c.Query("from")); err == nil {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse("2006-01-02", c.Query("to")); err == nil {
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	return query
+}
+
+func (a *App) actionAdminAuditIndex(c *gin.Context) {
+	db := a.requestDB(c)
+
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	var entries []AuditLog
+	a.auditQuery(c).Order("id desc").Offset((page - 1) * auditPageSize).Limit(auditPageSize + 1).Find(&entries)
+
+	hasNext := len(entries) > auditPageSize
+	if hasNext {
+		entries = entries[:auditPageSize]
+	}
+
+	var actions []string
+	db.Model(&AuditLog{}).Distinct("action").Order("action").Pluck("action", &actions)
+
+	var targetTypes []string
+	db.Model(&AuditLog{}).Where("target_type <> ''").Distinct("target_type").Order("target_type").Pluck("target_type", &targetTypes)
+
+	// Pagination and export links keep current filters
+	filters := c.Request.URL.Query()
+	pageURL := func(page int) string {
+		filters.Set("page", strconv.Itoa(page))
+		return "/admin/audit?" + filters.Encode()
+	}
+
+	h := gin.H{
+		"entries":     entries,
+		"actions":     actions,
+		"targetTypes": targetTypes,
+		"query":       c.Request.URL.Query(),
+	}
+	if page > 1 {
+		h["prevURL"] = pageURL(page - 1)
+	}
+	if hasNext {
+		h["nextURL"] = pageURL(page + 1)
+	}
+	filters.Del("page")
+	h["exportURL"] = "/admin/audit/export?" + filters.Encode()
+
+	renderHTML(c, http.StatusOK, "admin/audit/index.html", addFlashesAndUser(c, &h))
+}
+
+// actionAdminAuditExport downloads filtered audit log as CSV
+func (a *App) actionAdminAuditExport(c *gin.Context) {
+	db := a.requestDB(c)
+
+	rows, err := a.auditQuery(c).Order("id").Rows()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error exporting audit log: "+err.Error())
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-log-`+a.now().Format("20060102-150405")+`.csv"`)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "actor_login", "action", "target_type", "target_id", "changes", "details", "ip", "user_agent"})
+
+	for rows.Next() {
+		var entry AuditLog
+		if err := db.ScanRows(rows, &entry); err != nil {
+			a.Logger.ErrorContext(c, "Failed to export audit log", "request_id", c.GetString("requestID"), "error", err)
+			break
+		}
+
+		record := []string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			optionalID(entry.ActorID),
+			entry.ActorLogin,
+			entry.Action,
+			entry.TargetType,
+			optionalID(entry.TargetID),
+			entry.Changes,
+			entry.Details,
+			entry.IP,
+			entry.UserAgent,
+		}
+		for i := range record {
+			record[i] = csvSafeCell(record[i])
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+}
+
+// csvSafeCell prefixes value starting like a formula with "'", so that spreadsheets show it as text instead of
+// running it. Logins and user agents in audit log come from unauthenticated requests.
+func csvSafeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func optionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells current time to the app: timestamps of records, trash retention, active sessions
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// testClock is system clock that can be frozen or moved, used in test mode
+type testClock struct {
+	mu     sync.Mutex
+	frozen *time.Time
+	offset time.Duration
+}
+
+func (t *testClock) Now() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.frozen != nil {
+		return *t.frozen
+	}
+	return time.Now().Add(t.offset)
+}
+
+// Freeze stops the clock at moment
+func (t *testClock) Freeze(moment time.Time) {
+	t.mu.Lock()
+	t.frozen = &moment
+	t.mu.Unlock()
+}
+
+// Advance moves the clock forward by d, frozen clock stays frozen
+func (t *testClock) Advance(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.frozen != nil {
+		moved := t.frozen.Add(d)
+		t.frozen = &moved
+		return
+	}
+	t.offset += d
+}
+
+// Reset returns the clock to system time
+func (t *testClock) Reset() {
+	t.mu.Lock()
+	t.frozen = nil
+	t.offset = 0
+	t.mu.Unlock()
+}
+
+// Frozen reports whether the clock is stopped
+func (t *testClock) Frozen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.frozen != nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds settings of the app. loadConfig reads them from environment, tests can build it directly.
+type Config struct {
+	// Test enables /tools routes
+	Test bool
+
+	// "postgres", "sqlite" or "mysql"
+	DatabaseDriver string
+	DatabaseDSN    string
+	// Queries slower than this are logged as warnings, 0 disables
+	SlowQueryThreshold time.Duration
+
+	// Templates and static assets are read from these directories instead of the binary, and not cached
+	DevMode      bool
+	TemplatesDir string
+	StaticDir    string
+
+	// Locale of visitors whose browser accepts none of the translated locales
+	DefaultLocale string
+
+	// Absolute URL used in sitemaps, guessed from request if empty
+	BaseURL string
+	// File served as /robots.txt instead of the default rules
+	RobotsTxtFile string
+
+	MediaDir     string
+	MediaMaxSize int64
+
+	// Directory of fixtures loaded by /tools/fixtures
+	FixturesDir string
+
+	// Limits of /tools/sql queries
+	SQLConsoleTimeout time.Duration
+	SQLConsoleMaxRows int
+
+	// Trashed records older than this are purged, 0 keeps them forever
+	TrashRetention time.Duration
+
+	// Sign in expires after this time, counted by the clock of app
+	SessionLifetime time.Duration
+
+	// Addresses notified of new users, nobody is notified if empty
+	NotifyEmails []string
+
+	// "json" or "text"
+	LogFormat string
+	// Log level by component ("app", "http", "db")
+	LogLevels map[string]slog.Level
+
+	// Basic auth credentials of /metrics, not required if empty
+	MetricsUser     string
+	MetricsPassword string
+
+	HTTPAddr              string
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	ShutdownTimeout       time.Duration
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSSelfSigned         bool
+}
+
+// Components with separately configured log level
+var logComponents = []string{"app", "http", "db"}
+
+// envBool reports whether environment variable is set to a true value
+func envBool(name string) bool {
+	return (os.Getenv(name) == "1" || os.Getenv(name) == "true" || os.Getenv(name) == "yes" || os.Getenv(name) == "on" || os.Getenv(name) == "t")
+}
+
+// envString reads environment variable, falling back to def when it's not set
+func envString(name, def string) string {
+	if s := os.Getenv(name); s != "" {
+		return s
+	}
+	return def
+}
+
+// envList reads comma-separated environment variable, skipping empty items
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envDuration reads Go duration from environment variable, falling back to def when it's not set or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid "+name+", using default", "value", s, "default", def.String())
+		return def
+	}
+	return d
+}
+
+// envSize reads positive number (e.g. of bytes) from environment variable, falling back to def when it's not set or invalid
+func envSize(name string, def int64) int64 {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid "+name+", using default", "value", s, "default", def)
+		return def
+	}
+	return n
+}
+
+// envLogLevel parses level of component from LOG_LEVEL_<COMPONENT>, falling back to LOG_LEVEL and "info"
+func envLogLevel(component string) slog.Level {
+	s := envString("LOG_LEVEL_"+strings.ToUpper(component), os.Getenv("LOG_LEVEL"))
+	if s == "" {
+		return slog.LevelInfo
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		slog.Warn("Invalid log level of "+component+", using info", "value", s)
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// defaultDatabaseDSN returns DSN of database started by docker-compose, or of SQLite file in working dir
+// TODO: Move DB credentials into .env
+func defaultDatabaseDSN(driver string) string {
+	// Inside docker-compose the database is reachable by its service name
+	host := "localhost"
+	if isDocker() {
+		host = driver
+	}
+
+	switch driver {
+	case "sqlite":
+		return "app.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	case "mysql":
+		return "root:mysql@tcp(" + host + ":3306)/appdb?charset=utf8mb4&parseTime=True&loc=UTC"
+	default:
+		return "host=" + host + " user=postgres dbname=appdb password=postgres sslmode=disable"
+	}
+}
+
+func loadConfig() Config {
+	driver := envString("DB_DRIVER", "postgres")
+
+	cfg := Config{
+		Test: envBool("TEST"),
+
+		DatabaseDriver:     driver,
+		DatabaseDSN:        envString("DB_DSN", defaultDatabaseDSN(driver)),
+		SlowQueryThreshold: envDuration("DB_SLOW_QUERY_THRESHOLD", dbDefaultSlowQueryThreshold),
+
+		DevMode:      envBool("DEV_MODE"),
+		TemplatesDir: envString("TEMPLATES_DIR", "./templates"),
+		StaticDir:    envString("STATIC_DIR", "./static"),
+
+		DefaultLocale: envString("DEFAULT_LOCALE", sourceLocale),
+
+		BaseURL:       strings.TrimRight(os.Getenv("BASE_URL"), "/"),
+		RobotsTxtFile: os.Getenv("ROBOTS_TXT_FILE"),
+
+		MediaDir:     envString("MEDIA_DIR", mediaDefaultDir),
+		MediaMaxSize: envSize("MEDIA_MAX_SIZE", mediaDefaultMaxSize),
+
+		FixturesDir: envString("FIXTURES_DIR", fixturesDefaultDir),
+
+		SQLConsoleTimeout: envDuration("SQL_CONSOLE_TIMEOUT", sqlConsoleDefaultTimeout),
+		SQLConsoleMaxRows: int(envSize("SQL_CONSOLE_MAX_ROWS", sqlConsoleDefaultMaxRows)),
+
+		TrashRetention: envDuration("TRASH_RETENTION", trashDefaultRetention),
+
+		SessionLifetime: envDuration("SESSION_LIFETIME", sessionDefaultLifetime),
+
+		NotifyEmails: envList("NOTIFY_EMAIL"),
+
+		LogFormat: envString("LOG_FORMAT", "json"),
+		LogLevels: map[string]slog.Level{},
+
+		MetricsUser:     os.Getenv("METRICS_USER"),
+		MetricsPassword: os.Getenv("METRICS_PASSWORD"),
+
+		HTTPAddr:              envString("HTTP_ADDR", defaultHTTPAddr),
+		HTTPReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", defaultHTTPReadHeaderTimeout),
+		HTTPReadTimeout:       envDuration("HTTP_READ_TIMEOUT", defaultHTTPReadTimeout),
+		HTTPWriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", defaultHTTPWriteTimeout),
+		HTTPIdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", defaultHTTPIdleTimeout),
+		ShutdownTimeout:       envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
+		TLSCertFile:           os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:            os.Getenv("TLS_KEY_FILE"),
+		TLSSelfSigned:         envBool("TLS_SELF_SIGNED"),
+	}
+
+	for _, component := range logComponents {
+		cfg.LogLevels[component] = envLogLevel(component)
+	}
+
+	return cfg
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// editConflict describes differences between record being saved and record changed by someone else meanwhile
+type editConflict struct {
+	// Fields changed in either version
+	Fields []conflictField
+	// Content diff from saved version to version being saved
+	Diff []diffLine
+	// URL that reloads the form with saved version
+	DiscardURL string
+}
+
+type conflictField struct {
+	Name   string
+	Mine   string
+	Theirs string
+}
+
+// wantsJSON reports whether client prefers JSON to HTML (API clients sending Accept: application/json)
+func wantsJSON(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// formVersion returns version of record the form was opened with. Without it concurrent edits can't be detected,
+// so handlers refuse updates without version, see respondMissingVersion.
+func formVersion(c *gin.Context) (uint, bool) {
+	v, err := strconv.ParseUint(c.PostForm("version"), 10, 64)
+	if err != nil || v == 0 {
+		return 0, false
+	}
+	return uint(v), true
+}
+
+// respondMissingVersion responds to update without version of the edited record
+func respondMissingVersion(c *gin.Context) {
+	if wantsJSON(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Field version is required, send version of the record you edited"})
+		return
+	}
+	renderHTML(c, http.StatusBadRequest, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Version of the edited record is missing, reload the form and try again.")}}))
+}
+
+func boolString(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// pageConflict compares page being saved with page saved by someone else
+func pageConflict(mine, theirs Page) *editConflict {
+	conflict := &editConflict{DiscardURL: "/admin/pages/" + strconv.FormatUint(uint64(theirs.ID), 10) + "/edit"}
+
+	fields := []conflictField{
+		{"Slug", mine.Slug, theirs.Slug},
+		{"Title", mine.Title, theirs.Title},
+		{"Description", mine.Description, theirs.Description},
+		{"CanonicalURL", mine.CanonicalURL, theirs.CanonicalURL},
+		{"NoIndex", boolString(mine.NoIndex), boolString(theirs.NoIndex)},
+		{"Tags", mine.TagNames(), theirs.TagNames()},
+	}
+	for _, field := range fields {
+		if field.Mine != field.Theirs {
+			conflict.Fields = append(conflict.Fields, field)
+		}
+	}
+	// Category and OG image are compared by ID and shown by name
+	if !sameID(mine.CategoryID, theirs.CategoryID) {
+		conflict.Fields = append(conflict.Fields, conflictField{"Category", categoryPath(mine.Category), categoryPath(theirs.Category)})
+	}
+	if !sameID(mine.OGImageID, theirs.OGImageID) {
+		conflict.Fields = append(conflict.Fields, conflictField{"OGImage", mediaFilename(mine.OGImage), mediaFilename(theirs.OGImage)})
+	}
+
+	if mine.Content != theirs.Content {
+		conflict.Diff = diffLines(theirs.Content, mine.Content)
+	}
+
+	return conflict
+}
+
+// pageWithRelations returns page with category and OG image loaded by their IDs, as conflict screen shows their names
+func (a *App) pageWithRelations(c *gin.Context, page Page) Page {
+	db := a.requestDB(c)
+
+	page.Category = nil
+	if page.CategoryID != nil {
+		var category Category
+		if db.First(&category, *page.CategoryID).Error == nil {
+			page.Category = &category
+		}
+	}
+
+	page.OGImage = nil
+	if page.OGImageID != nil {
+		var media Media
+		if db.First(&media, *page.OGImageID).Error == nil {
+			page.OGImage = &media
+		}
+	}
+
+	return page
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func categoryPath(category *Category) string {
+	if category == nil {
+		return ""
+	}
+	return category.Path
+}
+
+func mediaFilename(media *Media) string {
+	if media == nil {
+		return ""
+	}
+	return media.Filename
+}
+
+// userConflict compares user being saved with user saved by someone else. Passwords are not shown.
+func userConflict(mine, theirs User) *editConflict {
+	conflict := &editConflict{DiscardURL: "/admin/users/" + strconv.FormatUint(uint64(theirs.ID), 10) + "/edit"}
+
+	if mine.Login != theirs.Login {
+		conflict.Fields = append(conflict.Fields, conflictField{"Login", mine.Login, theirs.Login})
+	}
+	if mine.Password != theirs.Password {
+		conflict.Fields = append(conflict.Fields, conflictField{"Password", "(changed)", "(changed)"})
+	}
+
+	return conflict
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want []diffLine
+	}{
+		{"same", "same", []diffLine{{"=", "same"}}},
+		{"a\nb\nc", "a\nc", []diffLine{{"=", "a"}, {"-", "b"}, {"=", "c"}}},
+		{"a\nc", "a\nb\nc", []diffLine{{"=", "a"}, {"+", "b"}, {"=", "c"}}},
+		{"a\nold\nc", "a\nnew\nc", []diffLine{{"=", "a"}, {"-", "old"}, {"+", "new"}, {"=", "c"}}},
+		{"", "x", []diffLine{{"-", ""}, {"+", "x"}}},
+	} {
+		if got := diffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diff of %q and %q: expected %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+// Texts too large for LCS table are shown as fully replaced
+func TestDiffLinesLarge(t *testing.T) {
+	a := strings.Repeat("line\n", 2001)
+	b := strings.Repeat("line\n", 2001) + "more"
+	got := diffLines(a, b)
+	if len(got) != 2002+2002 || got[0].Op != "-" || got[len(got)-1] != (diffLine{"+", "more"}) {
+		t.Fatalf("expected full replacement, got %d lines", len(got))
+	}
+}
+
+func TestPageConflict(t *testing.T) {
+	news, blog := uint(1), uint(2)
+	mine := Page{ID: 7, Slug: "about", Content: "a\nmine", CategoryID: &news, Category: &Category{Path: "news"}, Tags: []Tag{{Name: "x"}}}
+	theirs := Page{ID: 7, Slug: "about", Content: "a\ntheirs", CategoryID: &blog, Category: &Category{Path: "blog"}, OGImageID: &news, OGImage: &Media{Filename: "cover.jpg"}}
+
+	conflict := pageConflict(mine, theirs)
+	want := []conflictField{
+		{"Tags", "x", ""},
+		{"Category", "news", "blog"},
+		{"OGImage", "", "cover.jpg"},
+	}
+	if !reflect.DeepEqual(conflict.Fields, want) {
+		t.Fatalf("expected fields %v, got %v", want, conflict.Fields)
+	}
+	if !reflect.DeepEqual(conflict.Diff, []diffLine{{"=", "a"}, {"-", "theirs"}, {"+", "mine"}}) {
+		t.Fatalf("unexpected diff %v", conflict.Diff)
+	}
+	if conflict.DiscardURL != "/admin/pages/7/edit" {
+		t.Fatalf("unexpected discard URL %q", conflict.DiscardURL)
+	}
+
+	if conflict := pageConflict(theirs, theirs); len(conflict.Fields) != 0 || conflict.Diff != nil {
+		t.Fatalf("expected no differences, got %+v", conflict)
+	}
+}
+
+func TestAdminPagesUpdateConflict(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	about := createPage(t, a, Page{Slug: "about", Content: "intro\nold"})
+
+	news := Category{Name: "News", Slug: "news", Path: "news"}
+	if err := a.DB.Create(&news).Error; err != nil {
+		t.Fatal(err)
+	}
+	newsID := strconv.FormatUint(uint64(news.ID), 10)
+
+	// Someone else moves the page to a category and edits content
+	w := tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"intro\ntheirs"}, "category_id": {newsID}, "version": {"1"}})
+	assertRedirect(t, w, "/admin/pages")
+
+	// Form opened before that edit
+	w = tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"intro\nmine"}, "title": {"Mine"}, "version": {"1"}})
+	assertStatus(t, w, http.StatusConflict)
+	assertContains(t, w, `data-selenium="conflict"`)
+	assertContains(t, w, "<td>Title</td>\n            <td>Mine</td>\n            <td></td>")
+	assertContains(t, w, "<td>Category</td>\n            <td></td>\n            <td>news</td>")
+	assertContains(t, w, "<del>- theirs</del>")
+	assertContains(t, w, "<ins>+ mine</ins>")
+	// Saving the form again overwrites the current version
+	assertContains(t, w, `<input type="hidden" name="version" value="2">`)
+
+	page, err := a.Pages.Find(context.Background(), about.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Content != "intro\ntheirs" || page.Version != 2 {
+		t.Fatalf("conflicting update was saved: %+v", page)
+	}
+
+	assertRedirect(t, tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"intro\nmine"}, "version": {"2"}}), "/admin/pages")
+}
+
+// Update without version could overwrite someone else's changes unnoticed
+func TestUpdateRequiresVersion(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	bob := createUser(t, a, "bob")
+	about := createPage(t, a, Page{Slug: "about", Content: "Old"})
+
+	w := tc.postJSON(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"New"}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Field version is required")
+
+	w = tc.post(pagePath(about, "/update"), url.Values{"slug": {"about"}, "content": {"New"}, "version": {"x"}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Version of the edited record is missing")
+
+	assertStatus(t, tc.postJSON(userPath(bob, "/update"), url.Values{"login": {"bobby"}, "password": {"secret"}}), http.StatusBadRequest)
+	assertStatus(t, tc.post(userPath(bob, "/update"), url.Values{"login": {"bobby"}, "password": {"secret"}}), http.StatusBadRequest)
+
+	if page, _ := a.Pages.Find(context.Background(), about.ID); page.Content != "Old" {
+		t.Fatalf("update without version was saved: %+v", page)
+	}
+	if user, _ := a.Users.Find(context.Background(), bob.ID); user.Login != "bob" {
+		t.Fatalf("update without version was saved: %+v", user)
+	}
+}
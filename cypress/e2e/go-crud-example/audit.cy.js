@@ -0,0 +1,47 @@
+describe('Audit log', () => {
+    before(() => {
+        cy.resetDatabase();
+    });
+
+    beforeEach(() => {
+        cy.login();
+    });
+
+    after(() => {
+        cy.resetDatabase();
+    });
+
+    it('Records page changes', () => {
+        const uniqueName = `auditpage_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(uniqueName);
+        cy.get('#content').type('Sample content');
+        cy.get('button[type="submit"]').click();
+        cy.contains('Page was added.').should('be.visible');
+
+        cy.visit(`http://localhost:8080/admin/audit?action=create&target_type=page`);
+        cy.get('table tr').eq(1).should('contain', 'admin').and('contain', 'create').and('contain', uniqueName);
+    });
+
+    it('Redacts passwords', () => {
+        const uniqueName = `audituser_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/users/new`);
+        cy.get('#login').type(uniqueName);
+        cy.get('#password').type('secret_password');
+        cy.get('button[type="submit"]').click();
+        cy.contains('User was added.').should('be.visible');
+
+        cy.visit(`http://localhost:8080/admin/audit?action=create&target_type=user`);
+        cy.get('table tr').eq(1).should('contain', uniqueName).and('contain', '[REDACTED]').and('not.contain', 'secret_password');
+    });
+
+    it('Exports CSV', () => {
+        cy.request(`http://localhost:8080/admin/audit/export?action=login`).then((response) => {
+            expect(response.headers['content-type']).to.contain('text/csv');
+            expect(response.body).to.contain('actor_login');
+            expect(response.body).to.contain('login');
+        });
+    });
+})
@@ -16,7 +16,9 @@ describe('Page Management', () => {
         cy.get('h1').should('contain', 'Pages');
         cy.get('th').eq(0).should('contain', 'ID');
         cy.get('th').eq(1).should('contain', 'Slug');
-        cy.get('th').eq(2).should('contain', 'Actions');
+        cy.get('th').eq(2).should('contain', 'Category');
+        cy.get('th').eq(3).should('contain', 'Tags');
+        cy.get('th').eq(4).should('contain', 'Actions');
         cy.get('table tr').should('have.length.gt', 1);
         cy.get('table tr').eq(1).find('a').should('contain', 'Edit');
         cy.get('table tr').eq(1).find('form').should('exist');
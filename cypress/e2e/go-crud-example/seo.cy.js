@@ -0,0 +1,45 @@
+describe('Sitemap and robots.txt', () => {
+    before(() => {
+        cy.resetDatabase();
+    });
+
+    beforeEach(() => {
+        cy.login();
+    });
+
+    after(() => {
+        cy.resetDatabase();
+    });
+
+    it('Lists pages in sitemap.xml', () => {
+        cy.request(`http://localhost:8080/sitemap.xml`).then((response) => {
+            expect(response.status).to.eq(200)
+            expect(response.headers['content-type']).to.contain('application/xml')
+            expect(response.body).to.contain('<urlset')
+            expect(response.body).to.contain('/pages/about</loc>')
+            expect(response.body).to.contain('<lastmod>')
+        });
+    });
+
+    it('Updates sitemap.xml when pages change', () => {
+        const uniqueName = `sitemappage_${Date.now()}`;
+
+        cy.request(`http://localhost:8080/sitemap.xml`).its('body').should('not.contain', uniqueName);
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(uniqueName);
+        cy.get('#content').type('Sample content');
+        cy.get('button[type="submit"]').click();
+        cy.contains('Page was added.').should('be.visible');
+
+        cy.request(`http://localhost:8080/sitemap.xml`).its('body').should('contain', `/pages/${uniqueName}</loc>`);
+    });
+
+    it('Serves robots.txt', () => {
+        cy.request(`http://localhost:8080/robots.txt`).then((response) => {
+            expect(response.status).to.eq(200)
+            expect(response.body).to.contain('Disallow: /admin')
+            expect(response.body).to.contain('Sitemap: http://localhost:8080/sitemap.xml')
+        });
+    });
+})
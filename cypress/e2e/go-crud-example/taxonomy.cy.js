@@ -0,0 +1,62 @@
+describe('Tags and categories', () => {
+    before(() => {
+        cy.resetDatabase();
+    });
+
+    beforeEach(() => {
+        cy.login();
+    });
+
+    after(() => {
+        cy.resetDatabase();
+    });
+
+    it('Creates nested categories and lists their pages', () => {
+        const parent = `parent-${Date.now()}`;
+        const child = `child-${Date.now()}`;
+        const slug = `categorized_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/categories`);
+        cy.get('#name').type('Parent');
+        cy.get('#slug').type(parent);
+        cy.get('button[type="submit"]').click();
+        cy.contains('Category was added.').should('be.visible');
+
+        cy.get('#name').type('Child');
+        cy.get('#slug').type(child);
+        cy.get('#parent_id').select(parent);
+        cy.get('button[type="submit"]').click();
+        cy.contains(`${parent}/${child}`).should('exist');
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(slug);
+        cy.get('#content').type('Sample content');
+        cy.get('#category_id').select(`${parent}/${child}`);
+        cy.get('button[type="submit"]').click();
+        cy.contains('Page was added.').should('be.visible');
+
+        cy.visit(`http://localhost:8080/categories/${parent}`);
+        cy.get('[data-selenium="page-list"]').should('contain.text', slug);
+        cy.visit(`http://localhost:8080/categories/${parent}/${child}`);
+        cy.get('[data-selenium="page-list"]').should('contain.text', slug);
+    });
+
+    it('Tags pages and filters by tag', () => {
+        const slug = `tagged_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(slug);
+        cy.get('#content').type('Sample content');
+        cy.get('#tags').type('Go, Web Dev, go');
+        cy.get('button[type="submit"]').click();
+        cy.contains('Page was added.').should('be.visible');
+        cy.contains('tr', slug).should('contain.text', 'go').and('contain.text', 'web-dev');
+
+        cy.visit(`http://localhost:8080/admin/pages?tag=web-dev`);
+        cy.get('table tr').should('have.length', 2);
+        cy.contains('tr', slug).should('exist');
+
+        cy.visit(`http://localhost:8080/tags/go`);
+        cy.get('[data-selenium="page-list"]').should('contain.text', slug);
+    });
+})
@@ -13,6 +13,13 @@ describe('Tools', () => {
     });
   })
 
+  const SQL_URL = 'http://localhost:8080/tools/sql'
+  const JSON_HEADERS = { Accept: 'application/json' }
+  const INSERT_PAGE =
+    "INSERT INTO public.page (slug, content, created_at, updated_at) " +
+    "VALUES ( 'contact', 'Get in touch with us at contact@example.com', " +
+    "NOW(), NOW() );"
+
   /**
    * Verifies that GET /tools/sql?q=select+1
    * returns the expected JSON structure.
@@ -20,70 +27,108 @@ describe('Tools', () => {
   it('select 1', () => {
     cy.request({
       method: 'GET',
-      url: 'http://localhost:8080/tools/sql',
+      url: SQL_URL,
       qs: { q: 'select 1' },          // Cypress will URL-encode this to ?q=select+1
+      headers: JSON_HEADERS,
     }).then((response) => {
       expect(response.status).to.eq(200)
 
-      expect(response.body).to.deep.equal({
-        out: [{ '?column?': 1 }],
-        q: 'select 1'
-      })
+      expect(response.body).to.have.all.keys('q', 'write', 'columns', 'out', 'truncated', 'duration_ms')
+      expect(response.body.q).to.eq('select 1')
+      expect(response.body.write).to.eq(false)
+      expect(response.body.truncated).to.eq(false)
+      expect(response.body.columns.map((column) => column.name)).to.deep.equal(['?column?'])
+      expect(response.body.out).to.deep.equal([{ '?column?': 1 }])
+      expect(response.body.duration_ms).to.be.a('number')
     })
   })
 
-  it('delete from page', () => {
+  it('rejects writes sent with GET', () => {
     cy.request({
       method: 'GET',
-      url: 'http://localhost:8080/tools/sql',
+      url: SQL_URL,
+      qs: { q: 'delete from page', write: 1 },
+      headers: JSON_HEADERS,
+      failOnStatusCode: false
+    }).then((response) => {
+      expect(response.status).to.eq(400)
+      expect(response.body).to.deep.equal({ error: 'Write mode requires POST' })
+    })
+
+    // Without write=1 the query runs in read-only transaction
+    cy.request({
+      method: 'GET',
+      url: SQL_URL,
       qs: { q: 'delete from page' },
+      headers: JSON_HEADERS,
+      failOnStatusCode: false
+    }).then((response) => {
+      expect(response.status).to.eq(500)
+      expect(response.body.error).to.contain('read-only transaction')
+    })
+  })
+
+  it('rejects multiple statements in read-only mode', () => {
+    cy.request({
+      method: 'GET',
+      url: SQL_URL,
+      qs: { q: 'select 1; delete from page' },
+      headers: JSON_HEADERS,
+      failOnStatusCode: false
+    }).then((response) => {
+      expect(response.status).to.eq(400)
+      expect(response.body.error).to.contain('Error executing SQL query:')
+    })
+  })
+
+  it('delete from page', () => {
+    cy.request({
+      method: 'POST',
+      url: SQL_URL,
+      form: true,
+      body: { q: 'delete from page', write: 1 },
+      headers: JSON_HEADERS,
     }).then((response) => {
       expect(response.status).to.eq(200)
 
-      expect(response.body).to.deep.equal({
-        out: [],
-        q: 'delete from page'
-      })
+      expect(response.body.q).to.eq('delete from page')
+      expect(response.body.write).to.eq(true)
+      expect(response.body.out).to.deep.equal([])
     })
   })
 
   it('INSERT INTO public.page...', () => {
     cy.request({
-      method: 'GET',
-      url: 'http://localhost:8080/tools/sql',
-      qs: {
-        q:
-          "INSERT INTO public.page (slug, content, created_at, updated_at) " +
-          "VALUES ( 'contact', 'Get in touch with us at contact@example.com', " +
-          "NOW(), NOW() );"
-      },
+      method: 'POST',
+      url: SQL_URL,
+      form: true,
+      body: { q: INSERT_PAGE, write: 1 },
+      headers: JSON_HEADERS,
     }).then((response) => {
       expect(response.status).to.eq(200)
 
-      expect(response.body).to.deep.equal({
-        out: [],
-        q: "INSERT INTO public.page (slug, content, created_at, updated_at) " +
-          "VALUES ( 'contact', 'Get in touch with us at contact@example.com', " +
-          "NOW(), NOW() );"
-      })
+      expect(response.body.q).to.eq(INSERT_PAGE)
+      expect(response.body.write).to.eq(true)
+      expect(response.body.out).to.deep.equal([])
     })
   })
 
   it('select * from page', () => {
     cy.request({
       method: 'GET',
-      url: 'http://localhost:8080/tools/sql',
+      url: SQL_URL,
       qs: {
         q:
           "select * from page"
       },
+      headers: JSON_HEADERS,
     }).then((response) => {
       expect(response.status).to.eq(200)
 
       const jsonData = response.body;
 
       // Check for required fields
-      expect(jsonData).to.have.all.keys('out', 'q');
+      expect(jsonData).to.have.all.keys('q', 'write', 'columns', 'out', 'truncated', 'duration_ms');
 
       // Verify query value
       expect(jsonData.q).to.eq('select * from page');
@@ -106,8 +151,9 @@ describe('Tools', () => {
   it('handles errors', () => {
     cy.request({
       method: 'GET',
-      url: 'http://localhost:8080/tools/sql',
+      url: SQL_URL,
       qs: { q: 'select 1 from 1' },
+      headers: JSON_HEADERS,
       failOnStatusCode: false
     }).then((response) => {
       expect(response.status).to.eq(500)
@@ -0,0 +1,55 @@
+describe('Trash', () => {
+    before(() => {
+        cy.resetDatabase();
+    });
+
+    beforeEach(() => {
+        cy.login();
+    });
+
+    after(() => {
+        cy.resetDatabase();
+    });
+
+    it('Restores deleted pages', () => {
+        const uniqueName = `trashpage_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(uniqueName);
+        cy.get('#content').type('Sample content');
+        cy.get('button[type="submit"]').click();
+        cy.get(`[data-selenium="delete-${uniqueName}"]`).click();
+        cy.contains('Page was deleted').should('be.visible');
+
+        cy.visit(`http://localhost:8080/admin/trash`);
+        cy.get(`[data-selenium="restore-${uniqueName}"]`).click();
+        cy.contains('Page was restored.').should('be.visible');
+
+        cy.visit(`http://localhost:8080/pages/${uniqueName}`);
+        cy.get('h1').should('contain', uniqueName);
+    });
+
+    it('Allows reusing slug of trashed page', () => {
+        const uniqueName = `reusedslug_${Date.now()}`;
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(uniqueName);
+        cy.get('#content').type('First');
+        cy.get('button[type="submit"]').click();
+        cy.get(`[data-selenium="delete-${uniqueName}"]`).click();
+
+        cy.visit(`http://localhost:8080/admin/pages/new`);
+        cy.get('#slug').type(uniqueName);
+        cy.get('#content').type('Second');
+        cy.get('button[type="submit"]').click();
+        cy.contains('Page was added.').should('be.visible');
+
+        // Restoring would duplicate slug
+        cy.visit(`http://localhost:8080/admin/trash`);
+        cy.get(`[data-selenium="restore-${uniqueName}"]`).click();
+        cy.contains(`Page can't be restored: slug ${uniqueName} is already used.`).should('be.visible');
+
+        cy.get(`[data-selenium="purge-${uniqueName}"]`).click();
+        cy.contains('Page was permanently deleted.').should('be.visible');
+    });
+})
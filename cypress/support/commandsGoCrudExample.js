@@ -16,6 +16,25 @@ Cypress.Commands.add('resetDatabase', () => {
   });
 });
 
+// Loads fixture from fixtures/<name>.yaml into empty database, yields IDs of created records by ref
+Cypress.Commands.add('loadFixture', (name) => {
+  cy.request({
+    method: 'POST',
+    url: `http://localhost:8080/tools/fixtures/${name}?reset=1`,
+  }).then((response) => {
+    expect(response.status).to.eq(200)
+    return response.body.ids;
+  });
+});
+
+Cypress.Commands.add('saveSnapshot', (name) => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/snapshots/${name}` });
+});
+
+Cypress.Commands.add('restoreSnapshot', (name) => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/snapshots/${name}/restore` });
+});
+
 Cypress.Commands.add('login', ({ login, password } = DEFAULT_CREDS) => {
   cy.session([login, password], () => {
     cy.visit(`http://localhost:8080/login`);
@@ -26,3 +45,38 @@ Cypress.Commands.add('login', ({ login, password } = DEFAULT_CREDS) => {
     cy.getPath().should('eq', '/admin/users');
   });
 });
+
+// Signs in without the login form, only works when the app runs with TEST=true
+Cypress.Commands.add('loginAs', (login = DEFAULT_CREDS.login) => {
+  cy.request({
+    method: 'POST',
+    url: `http://localhost:8080/tools/login-as`,
+    form: true,
+    body: { login },
+  }).then((response) => {
+    expect(response.status).to.eq(200)
+  });
+});
+
+// Stops app clock at time (ISO 8601 string), e.g. to check dates shown on pages
+Cypress.Commands.add('freezeClock', (time) => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/clock/freeze`, form: true, body: { time } });
+});
+
+// Moves app clock forward by Go duration, e.g. '720h'
+Cypress.Commands.add('advanceClock', (by) => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/clock/advance`, form: true, body: { by } });
+});
+
+Cypress.Commands.add('resetClock', () => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/clock/reset` });
+});
+
+// Yields emails sent by the app since the outbox was cleared
+Cypress.Commands.add('sentMail', () => {
+  cy.request(`http://localhost:8080/tools/mail`).then((response) => response.body.mail);
+});
+
+Cypress.Commands.add('clearMail', () => {
+  cy.request({ method: 'POST', url: `http://localhost:8080/tools/mail/clear` });
+});
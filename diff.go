@@ -0,0 +1,68 @@
+package main
+
+import "strings"
+
+// Larger texts are shown as fully replaced instead of computing LCS table
+const diffMaxCells = 4_000_000
+
+type diffLine struct {
+	// Op is "=" for unchanged line, "-" for removed line, "+" for added line
+	Op   string
+	Text string
+}
+
+// diffLines returns line based diff turning a into b
+func diffLines(a, b string) []diffLine {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	var out []diffLine
+	if len(as)*len(bs) > diffMaxCells {
+		for _, line := range as {
+			out = append(out, diffLine{Op: "-", Text: line})
+		}
+		for _, line := range bs {
+			out = append(out, diffLine{Op: "+", Text: line})
+		}
+		return out
+	}
+
+	// lcs[i][j] is length of longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			out = append(out, diffLine{Op: "=", Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{Op: "-", Text: as[i]})
+			i++
+		default:
+			out = append(out, diffLine{Op: "+", Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		out = append(out, diffLine{Op: "-", Text: as[i]})
+	}
+	for ; j < len(bs); j++ {
+		out = append(out, diffLine{Op: "+", Text: bs[j]})
+	}
+
+	return out
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Records are inserted in batches of this size
+const factoryBatchSize = 500
+
+// Most records generated in one request of /tools/generate
+const factoryMaxRecords = 100000
+
+// Password of generated users
+const factoryPassword = "password"
+
+var (
+	factoryFirstNames = []string{"anna", "boris", "carla", "david", "elena", "felix", "greta", "hugo", "irina", "jakob", "kate", "leon", "maria", "nikolai", "olga", "peter", "quinn", "rosa", "sergei", "tanya", "ursula", "victor", "wanda", "xavier", "yulia", "zoe"}
+	factoryLastNames  = []string{"smith", "ivanov", "garcia", "muller", "rossi", "kowalski", "novak", "petrov", "silva", "jensen", "dubois", "nakamura", "kim", "lee", "brown", "wilson", "taylor", "moore", "martin", "clark"}
+
+	factoryAdjectives = []string{"quick", "simple", "practical", "complete", "modern", "hidden", "little", "honest", "better", "curious", "quiet", "useful", "common", "strange", "ultimate"}
+	factoryNouns      = []string{"guide", "garden", "kitchen", "journey", "river", "library", "workshop", "market", "village", "recipe", "bicycle", "camera", "harbor", "forest", "notebook", "teapot", "mountain", "festival"}
+	factoryVerbs      = []string{"building", "finding", "cleaning", "planning", "painting", "fixing", "choosing", "growing", "visiting", "learning", "cooking", "sharing"}
+	factoryWords      = []string{"the", "a", "small", "team", "every", "morning", "we", "found", "that", "old", "road", "near", "water", "people", "often", "ask", "about", "light", "time", "work", "city", "good", "first", "after", "long", "day", "simple", "idea", "change", "story", "house", "weather", "season", "friends", "plan", "open", "early", "quiet", "local", "fresh"}
+	factoryTags       = []string{"news", "howto", "travel", "food", "tech", "garden", "diy", "review", "photo", "family", "music", "books"}
+)
+
+// Factory generates realistic fake users and pages. Factories with the same seed generate the same records.
+type Factory struct {
+	rand *rand.Rand
+	// Appended to logins and slugs to keep them unique, incremented for every record
+	Seq int
+}
+
+func newFactory(seed int64) *Factory {
+	return &Factory{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (f *Factory) pick(words []string) string {
+	return words[f.rand.Intn(len(words))]
+}
+
+// User returns new user with login like "anna.smith12"
+func (f *Factory) User() User {
+	f.Seq++
+	return User{Login: f.pick(factoryFirstNames) + "." + f.pick(factoryLastNames) + strconv.Itoa(f.Seq), Password: factoryPassword}
+}
+
+// Page returns new page with Markdown content and names of its tags
+func (f *Factory) Page() (Page, []string) {
+	f.Seq++
+
+	words := []string{f.pick(factoryVerbs), "a", f.pick(factoryAdjectives), f.pick(factoryNouns)}
+	title := strings.ToUpper(words[0][:1]) + words[0][1:] + " " + strings.Join(words[1:], " ")
+	slug := strings.Join(words, "-") + "-" + strconv.Itoa(f.Seq)
+
+	page := Page{
+		Slug:        slug,
+		Title:       title,
+		Description: f.sentence(),
+		Content:     f.markdown(title),
+	}
+
+	var tags []string
+	for _, i := range f.rand.Perm(len(factoryTags))[:f.rand.Intn(4)] {
+		tags = append(tags, factoryTags[i])
+	}
+	return page, tags
+}
+
+func (f *Factory) sentence() string {
+	n := 6 + f.rand.Intn(10)
+	words := make([]string, n)
+	for i := range words {
+		words[i] = f.pick(factoryWords)
+	}
+	s := strings.Join(words, " ")
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+func (f *Factory) paragraph() string {
+	sentences := make([]string, 2+f.rand.Intn(4))
+	for i := range sentences {
+		sentences[i] = f.sentence()
+	}
+	return strings.Join(sentences, " ")
+}
+
+// markdown returns body with heading, paragraphs, a list and sometimes emphasis, a link or a quote
+func (f *Factory) markdown(title string) string {
+	var b strings.Builder
+	b.WriteString("# " + title + "\n\n")
+	b.WriteString(f.paragraph() + "\n\n")
+
+	b.WriteString("## " + strings.TrimSuffix(f.sentence(), ".") + "\n\n")
+	for i := 0; i < 2+f.rand.Intn(3); i++ {
+		b.WriteString("- " + f.pick(factoryAdjectives) + " " + f.pick(factoryNouns) + "\n")
+	}
+	b.WriteString("\n")
+
+	switch f.rand.Intn(3) {
+	case 0:
+		b.WriteString("> " + f.sentence() + "\n\n")
+	case 1:
+		b.WriteString("Read more about the **" + f.pick(factoryNouns) + "** on [our " + f.pick(factoryNouns) + " page](/" + f.pick(factoryNouns) + ").\n\n")
+	}
+
+	b.WriteString(f.paragraph() + "\n")
+	return b.String()
+}
+
+// GenerateOptions tells how many records generateData creates
+type GenerateOptions struct {
+	Seed  int64
+	Users int
+	Pages int
+}
+
+// generateData inserts generated users and pages in batches in one transaction. Numbers in logins and slugs continue
+// after the largest ID of existing records, so data can be generated into the same database again. Number of generated
+// record never exceeds its ID, so new numbers are unused even after records were purged.
+func generateData(ctx context.Context, db *gorm.DB, opts GenerateOptions) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		f := newFactory(opts.Seed)
+		var err error
+		if f.Seq, err = maxID(tx, &User{}); err != nil {
+			return err
+		}
+
+		users := make([]User, 0, min(opts.Users, factoryBatchSize))
+		for i := 0; i < opts.Users; i++ {
+			users = append(users, f.User())
+			if len(users) == cap(users) || i == opts.Users-1 {
+				if err := tx.Create(&users).Error; err != nil {
+					return err
+				}
+				users = users[:0]
+			}
+		}
+
+		if opts.Pages == 0 {
+			return nil
+		}
+
+		if f.Seq, err = maxID(tx, &Page{}); err != nil {
+			return err
+		}
+
+		tagIDs := map[string]uint{}
+		for _, name := range factoryTags {
+			tag := Tag{Name: name}
+			if err := tx.Where(tag).FirstOrCreate(&tag).Error; err != nil {
+				return err
+			}
+			tagIDs[name] = tag.ID
+		}
+
+		pages := make([]Page, 0, min(opts.Pages, factoryBatchSize))
+		var pageTags [][]string
+		for i := 0; i < opts.Pages; i++ {
+			page, tags := f.Page()
+			pages = append(pages, page)
+			pageTags = append(pageTags, tags)
+			if len(pages) < cap(pages) && i < opts.Pages-1 {
+				continue
+			}
+
+			if err := tx.Omit("Tags").Create(&pages).Error; err != nil {
+				return err
+			}
+			var links []map[string]interface{}
+			for j, page := range pages {
+				for _, name := range pageTags[j] {
+					links = append(links, map[string]interface{}{"page_id": page.ID, "tag_id": tagIDs[name]})
+				}
+			}
+			if len(links) > 0 {
+				if err := tx.Table("page_tags").Create(links).Error; err != nil {
+					return err
+				}
+			}
+			pages, pageTags = pages[:0], pageTags[:0]
+		}
+
+		return nil
+	})
+}
+
+// maxID returns the largest ID of records of model including trashed ones, 0 for empty table
+func maxID(db *gorm.DB, model interface{}) (int, error) {
+	var id int
+	err := db.Unscoped().Model(model).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// parseGenerateOptions reads options of "generate" command
+func parseGenerateOptions(args []string, output io.Writer) (GenerateOptions, error) {
+	var opts GenerateOptions
+
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Int64Var(&opts.Seed, "seed", 1, "seed of random data, the same seed generates the same records")
+	fs.IntVar(&opts.Users, "users", 0, "number of users")
+	fs.IntVar(&opts.Pages, "pages", 0, "number of pages")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if opts.Users < 0 || opts.Pages < 0 {
+		err := fmt.Errorf("number of records can't be negative")
+		fmt.Fprintln(output, err)
+		return opts, err
+	}
+	return opts, nil
+}
+
+// generateOptionsFromRequest reads "users", "pages" and "seed" parameters, missing numbers are 0 and missing seed is 1
+func generateOptionsFromRequest(c *gin.Context) (GenerateOptions, error) {
+	opts := GenerateOptions{Seed: 1}
+
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"users", &opts.Users}, {"pages", &opts.Pages}} {
+		value := formOrQuery(c, p.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > factoryMaxRecords {
+			return opts, fmt.Errorf("'%s' must be a number from 0 to %d", p.name, factoryMaxRecords)
+		}
+		*p.value = n
+	}
+
+	if value := formOrQuery(c, "seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("'seed' must be a number")
+		}
+		opts.Seed = seed
+	}
+
+	return opts, nil
+}
+
+// actionPublicToolsGenerate generates "users" users and "pages" pages from "seed"
+func (a *App) actionPublicToolsGenerate(c *gin.Context) {
+	session := sessions.Default(c)
+
+	opts, err := generateOptionsFromRequest(c)
+	if err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/tools")
+		return
+	}
+
+	err = generateData(c.Request.Context(), a.DB, opts)
+
+	a.auditDetails(c, "tools.generate", "", 0, nil, nil, fmt.Sprintf("seed: %d, users: %d, pages: %d", opts.Seed, opts.Users, opts.Pages))
+	a.invalidateSEOCache()
+
+	if wantsJSON(c) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating data: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"seed": opts.Seed, "users": opts.Users, "pages": opts.Pages})
+		return
+	}
+
+	if err != nil {
+		session.AddFlash("Error generating data: " + err.Error())
+	} else {
+		session.AddFlash(fmt.Sprintf("Generated %d users and %d pages.", opts.Users, opts.Pages))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/tools")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFactoryDeterministic(t *testing.T) {
+	a, b := newFactory(42), newFactory(42)
+	for i := 0; i < 10; i++ {
+		if ua, ub := a.User(), b.User(); ua != ub {
+			t.Fatalf("users differ: %+v %+v", ua, ub)
+		}
+		pa, ta := a.Page()
+		pb, tb := b.Page()
+		if !reflect.DeepEqual(pa, pb) || !reflect.DeepEqual(ta, tb) {
+			t.Fatalf("pages differ: %+v %+v", pa, pb)
+		}
+	}
+
+	if newFactory(1).User() == newFactory(2).User() {
+		t.Fatal("expected different seeds to generate different users")
+	}
+
+	page, _ := newFactory(1).Page()
+	if !strings.HasPrefix(page.Content, "# "+page.Title+"\n") || !strings.Contains(page.Content, "\n- ") {
+		t.Fatalf("expected Markdown with heading and list, got %q", page.Content)
+	}
+}
+
+func TestGenerateData(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+
+	opts := GenerateOptions{Seed: 7, Users: factoryBatchSize + 3, Pages: 25}
+	if err := generateData(ctx, a.DB, opts); err != nil {
+		t.Fatal(err)
+	}
+	// Generating again continues numbering instead of failing on duplicates
+	if err := generateData(ctx, a.DB, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := a.Users.Count(ctx); count != int64(2*opts.Users) {
+		t.Fatalf("expected %d users, got %d", 2*opts.Users, count)
+	}
+	pages, err := a.Pages.List(ctx, PageFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2*opts.Pages {
+		t.Fatalf("expected %d pages, got %d", 2*opts.Pages, len(pages))
+	}
+
+	var tagged int64
+	a.DB.Table("page_tags").Count(&tagged)
+	if tagged == 0 {
+		t.Fatal("expected generated pages to have tags")
+	}
+}
+
+// Numbering starts after the largest ID, so purged records don't make numbers repeat
+func TestGenerateDataAfterPurge(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+
+	opts := GenerateOptions{Seed: 7, Users: 3}
+	if err := generateData(ctx, a.DB, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DB.Unscoped().Where("id = ?", 1).Delete(&User{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := generateData(ctx, a.DB, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := a.Users.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 5 {
+		t.Fatalf("expected 5 users, got %d", len(users))
+	}
+	for _, user := range users {
+		if !strings.HasSuffix(user.Login, strconv.Itoa(int(user.ID))) {
+			t.Errorf("expected login %q to be numbered with its ID %d", user.Login, user.ID)
+		}
+	}
+}
+
+func TestParseGenerateOptions(t *testing.T) {
+	opts, err := parseGenerateOptions([]string{"-users", "10", "-pages", "20", "-seed", "3"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts != (GenerateOptions{Seed: 3, Users: 10, Pages: 20}) {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	if _, err := parseGenerateOptions([]string{"-users", "-1"}, io.Discard); err == nil {
+		t.Fatal("expected error for negative number")
+	}
+}
+
+func TestToolsGenerate(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	assertContains(t, tc.follow(tc.post("/tools/generate", url.Values{"users": {"many"}})), "&#39;users&#39; must be a number")
+
+	w := tc.post("/tools/generate", url.Values{"users": {"3"}, "pages": {"2"}, "seed": {"5"}})
+	assertRedirect(t, w, "/tools")
+	assertContains(t, tc.follow(w), "Generated 3 users and 2 pages.")
+
+	w = tc.postJSON("/tools/generate", url.Values{"pages": {"1"}})
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"pages":1`)
+
+	if count, _ := a.Users.Count(context.Background()); count != 3 {
+		t.Fatalf("expected 3 users, got %d", count)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Default of FIXTURES_DIR
+const fixturesDefaultDir = "./fixtures"
+
+// Fixture and snapshot names are used in URLs and file names
+var fixtureNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var errFixtureNotFound = errors.New("fixture not found")
+
+// Fixture is a named set of records loaded from FIXTURES_DIR/<name>.yaml (or .yml, .json).
+// Records refer to each other by ref, which defaults to login of users, path of categories and slug of pages.
+type Fixture struct {
+	Users      []FixtureUser     `yaml:"users" json:"users"`
+	Categories []FixtureCategory `yaml:"categories" json:"categories"`
+	Pages      []FixturePage     `yaml:"pages" json:"pages"`
+}
+
+type FixtureUser struct {
+	Ref      string `yaml:"ref" json:"ref"`
+	Login    string `yaml:"login" json:"login"`
+	Password string `yaml:"password" json:"password"`
+}
+
+type FixtureCategory struct {
+	Ref  string `yaml:"ref" json:"ref"`
+	Name string `yaml:"name" json:"name"`
+	Slug string `yaml:"slug" json:"slug"`
+	// Ref of parent category, parents must be listed before their children
+	Parent string `yaml:"parent" json:"parent"`
+}
+
+type FixturePage struct {
+	Ref          string `yaml:"ref" json:"ref"`
+	Slug         string `yaml:"slug" json:"slug"`
+	Title        string `yaml:"title" json:"title"`
+	Description  string `yaml:"description" json:"description"`
+	Content      string `yaml:"content" json:"content"`
+	CanonicalURL string `yaml:"canonical_url" json:"canonical_url"`
+	NoIndex      bool   `yaml:"no_index" json:"no_index"`
+	// Ref of category
+	Category string   `yaml:"category" json:"category"`
+	Tags     []string `yaml:"tags" json:"tags"`
+}
+
+// FixtureIDs maps refs of loaded records to their IDs
+type FixtureIDs struct {
+	Users      map[string]uint `json:"users"`
+	Categories map[string]uint `json:"categories"`
+	Pages      map[string]uint `json:"pages"`
+}
+
+// readFixture reads fixture file from dir
+func readFixture(dir, name string) (*Fixture, error) {
+	if !fixtureNameRe.MatchString(name) {
+		return nil, errFixtureNotFound
+	}
+
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		content, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var fixture Fixture
+		if ext == ".json" {
+			err = json.Unmarshal(content, &fixture)
+		} else {
+			err = yaml.Unmarshal(content, &fixture)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", name, err)
+		}
+		return &fixture, nil
+	}
+
+	return nil, errFixtureNotFound
+}
+
+// listFixtures returns names of fixtures in dir
+func listFixtures(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") || !fixtureNameRe.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// loadFixture inserts records of fixture in one transaction
+func loadFixture(ctx context.Context, db *gorm.DB, fixture *Fixture) (*FixtureIDs, error) {
+	ids := &FixtureIDs{Users: map[string]uint{}, Categories: map[string]uint{}, Pages: map[string]uint{}}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := newGormUserRepository(tx)
+		for _, u := range fixture.Users {
+			user := User{Login: u.Login, Password: u.Password}
+			if err := users.Create(ctx, &user); err != nil {
+				return fmt.Errorf("user %s: %w", u.Login, err)
+			}
+			ids.Users[fixtureRef(u.Ref, u.Login)] = user.ID
+		}
+
+		paths := map[string]string{}
+		for _, c := range fixture.Categories {
+			category := Category{Name: c.Name, Slug: c.Slug, Path: c.Slug}
+			if category.Name == "" {
+				category.Name = c.Slug
+			}
+			if c.Parent != "" {
+				parentID, ok := ids.Categories[c.Parent]
+				if !ok {
+					return fmt.Errorf("category %s: unknown parent %q", c.Slug, c.Parent)
+				}
+				category.ParentID = &parentID
+				category.Path = paths[c.Parent] + "/" + c.Slug
+			}
+			if err := tx.Create(&category).Error; err != nil {
+				return fmt.Errorf("category %s: %w", category.Path, err)
+			}
+			ref := fixtureRef(c.Ref, category.Path)
+			ids.Categories[ref] = category.ID
+			paths[ref] = category.Path
+		}
+
+		pages := newGormPageRepository(tx)
+		for _, p := range fixture.Pages {
+			page := Page{
+				Slug:         p.Slug,
+				Title:        p.Title,
+				Description:  p.Description,
+				Content:      p.Content,
+				CanonicalURL: p.CanonicalURL,
+				NoIndex:      p.NoIndex,
+			}
+			if p.Category != "" {
+				categoryID, ok := ids.Categories[p.Category]
+				if !ok {
+					return fmt.Errorf("page %s: unknown category %q", p.Slug, p.Category)
+				}
+				page.CategoryID = &categoryID
+			}
+
+			var tags []Tag
+			for _, name := range p.Tags {
+				tags = append(tags, Tag{Name: name})
+			}
+			if err := pages.Create(ctx, &page, tags); err != nil {
+				return fmt.Errorf("page %s: %w", p.Slug, err)
+			}
+			ids.Pages[fixtureRef(p.Ref, p.Slug)] = page.ID
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func fixtureRef(ref, def string) string {
+	if ref != "" {
+		return ref
+	}
+	return def
+}
+
+// clearDB deletes all users, pages with their tags and categories, and media records in one transaction.
+// Audit log and SQL console history are kept, like by snapshots. Files of media stay in storage.
+func clearDB(db *gorm.DB) error {
+	tables := []struct{ table, title string }{
+		{"user", "users"},
+		{"page_tags", "page tags"},
+		{"page_translation", "page translations"},
+		{"page", "pages"},
+		{"tag", "tags"},
+		{"category", "categories"},
+		{"media", "media"},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Subcategories are unlinked first, MySQL checks foreign keys row by row
+		if err := tx.Exec("UPDATE ? SET parent_id = NULL", clause.Table{Name: "category"}).Error; err != nil {
+			return fmt.Errorf("clearing categories: %w", err)
+		}
+		for _, t := range tables {
+			if err := tx.Exec("DELETE FROM ?", clause.Table{Name: t.table}).Error; err != nil {
+				return fmt.Errorf("clearing %s: %w", t.title, err)
+			}
+		}
+		return nil
+	})
+}
+
+// snapshotTable is content of one table
+type snapshotTable struct {
+	Name string
+	Rows []map[string]interface{}
+}
+
+// snapshotStore keeps named copies of the whole database in memory
+type snapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string][]snapshotTable
+}
+
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{snapshots: map[string][]snapshotTable{}}
+}
+
+// Rows of tables are copied in this order, so that parents are inserted before rows referring to them
+var snapshotOrder = map[string]string{"category": "path"}
+
+// Audit log can't be changed through the app, SQL console history and saved queries are kept like by /tools/db-clear
+var snapshotExcludedTables = map[string]bool{"audit_log": true, "sql_query": true, "saved_sql_query": true}
+
+// snapshotTables returns tables of migratedModels and their join tables, parents first
+func snapshotTables(db *gorm.DB) ([]string, error) {
+	var tables []string
+	seen := map[string]bool{}
+
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if !seen[stmt.Schema.Table] && !snapshotExcludedTables[stmt.Schema.Table] {
+			seen[stmt.Schema.Table] = true
+			tables = append(tables, stmt.Schema.Table)
+		}
+		for _, rel := range stmt.Schema.Relationships.Many2Many {
+			if !seen[rel.JoinTable.Table] {
+				seen[rel.JoinTable.Table] = true
+				tables = append(tables, rel.JoinTable.Table)
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+// saveSnapshot copies all tables of database under name, replacing previous snapshot with the same name
+func (a *App) saveSnapshot(ctx context.Context, name string) error {
+	tables, err := snapshotTables(a.DB)
+	if err != nil {
+		return err
+	}
+
+	var snapshot []snapshotTable
+	err = a.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			query := tx.Table(table)
+			if order, ok := snapshotOrder[table]; ok {
+				query = query.Order(order)
+			}
+
+			rows := []map[string]interface{}{}
+			if err := query.Find(&rows).Error; err != nil {
+				return err
+			}
+			// Generated columns of MySQL active unique indexes can't be inserted
+			for _, index := range activeUniqueIndexes {
+				if index.table != table {
+					continue
+				}
+				for _, row := range rows {
+					delete(row, index.column+"_active")
+				}
+			}
+			snapshot = append(snapshot, snapshotTable{Name: table, Rows: rows})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.snapshots.mu.Lock()
+	a.snapshots.snapshots[name] = snapshot
+	a.snapshots.mu.Unlock()
+	return nil
+}
+
+// restoreSnapshot replaces content of all tables with snapshot. Returns false if there's no snapshot with name.
+func (a *App) restoreSnapshot(ctx context.Context, name string) (bool, error) {
+	a.snapshots.mu.Lock()
+	snapshot, ok := a.snapshots.snapshots[name]
+	a.snapshots.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	err := a.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE ? SET parent_id = NULL", clause.Table{Name: "category"}).Error; err != nil {
+			return err
+		}
+		for i := len(snapshot) - 1; i >= 0; i-- {
+			if err := tx.Exec("DELETE FROM ?", clause.Table{Name: snapshot[i].Name}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, table := range snapshot {
+			if len(table.Rows) == 0 {
+				continue
+			}
+			// Rows are copied, gorm sets generated values in inserted maps
+			rows := make([]map[string]interface{}, len(table.Rows))
+			for i, row := range table.Rows {
+				rows[i] = make(map[string]interface{}, len(row))
+				for k, v := range row {
+					rows[i][k] = v
+				}
+			}
+			if err := tx.Table(table.Name).CreateInBatches(rows, 100).Error; err != nil {
+				return fmt.Errorf("restoring %s: %w", table.Name, err)
+			}
+			if err := resetSequence(tx, table.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+// resetSequence moves Postgres ID sequence of table past inserted IDs. SQLite and MySQL do it on insert.
+func resetSequence(db *gorm.DB, table string) error {
+	if db.Dialector.Name() != "postgres" || !db.Migrator().HasColumn(table, "id") {
+		return nil
+	}
+	return db.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM ?), false)",
+		db.Statement.Quote(table), clause.Table{Name: table}).Error
+}
+
+// snapshotNames returns names of saved snapshots
+func (a *App) snapshotNames() []string {
+	a.snapshots.mu.Lock()
+	defer a.snapshots.mu.Unlock()
+
+	names := []string{}
+	for name := range a.snapshots.snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deleteSnapshot forgets snapshot, returns false if there was none
+func (a *App) deleteSnapshot(name string) bool {
+	a.snapshots.mu.Lock()
+	defer a.snapshots.mu.Unlock()
+
+	_, ok := a.snapshots.snapshots[name]
+	delete(a.snapshots.snapshots, name)
+	return ok
+}
+
+// actionPublicToolsFixturesIndex lists fixtures and snapshots
+func (a *App) actionPublicToolsFixturesIndex(c *gin.Context) {
+	fixtures, err := listFixtures(a.Config.FixturesDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fixtures": fixtures, "snapshots": a.snapshotNames()})
+}
+
+// actionPublicToolsFixturesLoad loads fixture and returns IDs of created records. With reset=1 database is cleared first.
+func (a *App) actionPublicToolsFixturesLoad(c *gin.Context) {
+	name := c.Param("name")
+
+	fixture, err := readFixture(a.Config.FixturesDir, name)
+	if errors.Is(err, errFixtureNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Database is cleared in the same transaction, so it stays as it was if the fixture fails to load
+	reset := formOrQuery(c, "reset") != ""
+	var ids *FixtureIDs
+	var clearErr error
+	err = a.requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if reset {
+			if clearErr = clearDB(tx); clearErr != nil {
+				return clearErr
+			}
+		}
+		loaded, err := loadFixture(c.Request.Context(), tx, fixture)
+		ids = loaded
+		return err
+	})
+	if clearErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error clearing database: " + clearErr.Error()})
+		return
+	}
+
+	a.auditDetails(c, "tools.fixture_load", "", 0, nil, nil, name)
+	a.invalidateSEOCache()
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Error loading fixture: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fixture": name, "ids": ids})
+}
+
+// actionPublicToolsSnapshotsCreate saves current database state under name
+func (a *App) actionPublicToolsSnapshotsCreate(c *gin.Context) {
+	name := c.Param("name")
+	if !fixtureNameRe.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot name"})
+		return
+	}
+
+	if err := a.saveSnapshot(c.Request.Context(), name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving snapshot: " + err.Error()})
+		return
+	}
+
+	a.auditDetails(c, "tools.snapshot_save", "", 0, nil, nil, name)
+	c.JSON(http.StatusOK, gin.H{"snapshot": name})
+}
+
+// actionPublicToolsSnapshotsRestore replaces database state with snapshot
+func (a *App) actionPublicToolsSnapshotsRestore(c *gin.Context) {
+	name := c.Param("name")
+
+	found, err := a.restoreSnapshot(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error restoring snapshot: " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	}
+
+	a.auditDetails(c, "tools.snapshot_restore", "", 0, nil, nil, name)
+	a.invalidateSEOCache()
+	c.JSON(http.StatusOK, gin.H{"snapshot": name})
+}
+
+// actionPublicToolsSnapshotsDestroy deletes snapshot
+func (a *App) actionPublicToolsSnapshotsDestroy(c *gin.Context) {
+	if !a.deleteSnapshot(c.Param("name")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshot": c.Param("name")})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Version of the app, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// How long each dependency check may take
+const healthCheckTimeout = 2 * time.Second
+
+// healthCheck is result of checking one dependency
+type healthCheck struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+func runHealthCheck(name string, check func(ctx context.Context) error) healthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := healthCheck{Name: name, OK: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (a *App) checkDatabase(ctx context.Context) error {
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkMigrations verifies that tables and columns of all models exist
+func (a *App) checkMigrations(ctx context.Context) error {
+	if a.migrationsCurrent.Load() {
+		return nil
+	}
+
+	tx := a.DB.WithContext(ctx)
+	migrator := tx.Migrator()
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("missing table %s", stmt.Schema.Table)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				return fmt.Errorf("missing column %s.%s", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
+	a.migrationsCurrent.Store(true)
+	return nil
+}
+
+func (a *App) checkTemplates(ctx context.Context) error {
+	if a.Renderer == nil {
+		return errors.New("templates are not loaded")
+	}
+	return nil
+}
+
+// checkMediaStorage writes and removes probe file. Key is random as storage refuses to overwrite files.
+func (a *App) checkMediaStorage(ctx context.Context) error {
+	key := ".healthcheck-" + newRequestID()
+	if err := a.Storage.Save(key, strings.NewReader("ok")); err != nil {
+		return err
+	}
+	return a.Storage.Delete(key)
+}
+
+// readinessChecks are dependencies the app can't serve requests without
+func (a *App) readinessChecks() []healthCheck {
+	return []healthCheck{
+		runHealthCheck("database", a.checkDatabase),
+		runHealthCheck("migrations", a.checkMigrations),
+		runHealthCheck("templates", a.checkTemplates),
+	}
+}
+
+func healthChecksOK(checks []healthCheck) bool {
+	for _, check := range checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// healthCheckStatuses returns "ok" or "fail" for each check by its name. Unauthenticated probes get only these,
+// errors may reveal internals (DSN, schema) and are shown on admin status page.
+func healthCheckStatuses(checks []healthCheck) map[string]string {
+	statuses := map[string]string{}
+	for _, check := range checks {
+		statuses[check.Name] = "ok"
+		if !check.OK {
+			statuses[check.Name] = "fail"
+		}
+	}
+	return statuses
+}
+
+// actionHealthz reports that process is alive
+func actionHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// actionReadyz reports whether app is ready to serve requests
+func (a *App) actionReadyz(c *gin.Context) {
+	if a.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	checks := a.readinessChecks()
+	if !healthChecksOK(checks) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "fail", "checks": healthCheckStatuses(checks)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": healthCheckStatuses(checks)})
+}
+
+// buildInfo returns Go version and VCS revision the binary was built from
+func buildInfo() map[string]string {
+	info := map[string]string{"go_version": runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			info[setting.Key] = setting.Value
+		}
+	}
+	return info
+}
+
+// actionAdminStatus shows version, uptime, build info and state of all dependencies
+func (a *App) actionAdminStatus(c *gin.Context) {
+	checks := append(a.readinessChecks(), runHealthCheck("media storage", a.checkMediaStorage))
+
+	status := gin.H{
+		"ok":         healthChecksOK(checks),
+		"version":    version,
+		"started_at": a.startedAt,
+		"uptime":     time.Since(a.startedAt).Round(time.Second).String(),
+		"build":      buildInfo(),
+		"checks":     checks,
+	}
+
+	code := http.StatusOK
+	if !healthChecksOK(checks) {
+		code = http.StatusServiceUnavailable
+	}
+
+	if wantsJSON(c) {
+		c.JSON(code, status)
+		return
+	}
+	renderHTML(c, code, "admin/status.html", addFlashesAndUser(c, &gin.H{"status": status}))
+}
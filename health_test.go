@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	w := tc.get("/readyz")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `"database":"ok"`)
+
+	// Failed check is reported without its error, which is shown to admins only
+	a.Renderer = nil
+	w = tc.get("/readyz")
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "fail" || body.Checks["templates"] != "fail" || body.Checks["migrations"] != "ok" {
+		t.Fatalf("unexpected readiness %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "not loaded") {
+		t.Fatalf("expected no error details, got %s", w.Body.String())
+	}
+
+	w = loginAsAdmin(t, a).getJSON("/status")
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	assertContains(t, w, "templates are not loaded")
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"gopkg.in/yaml.v3"
+)
+
+// Messages in code and templates are written in this locale and used as keys of catalogs
+const sourceLocale = "en"
+
+// message is translation of one key: plain text, or text of each plural form ("one", "few", "many", "other")
+type message struct {
+	Text  string
+	Forms map[string]string
+}
+
+func (m *message) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Text)
+	}
+	return node.Decode(&m.Forms)
+}
+
+// catalogFile is contents of locales/<locale>.yaml
+type catalogFile struct {
+	// Name of language in itself, shown in language switcher
+	Name     string             `yaml:"name"`
+	Messages map[string]message `yaml:"messages"`
+}
+
+// catalog holds translated messages of every locale. Keys are English messages, so messages missing in catalog
+// are shown in English.
+type catalog struct {
+	locales []string
+	files   map[string]catalogFile
+}
+
+// Catalogs of locales/*.yaml built into the binary
+var messages = mustLoadCatalog(localesFS())
+
+func mustLoadCatalog(fsys fs.FS) *catalog {
+	c, err := loadCatalog(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// loadCatalog reads <locale>.yaml files of fsys
+func loadCatalog(fsys fs.FS) (*catalog, error) {
+	names, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &catalog{files: map[string]catalogFile{}}
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var file catalogFile
+		if err := yaml.Unmarshal(content, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for key, m := range file.Messages {
+			if m.Forms != nil && m.Forms["other"] == "" {
+				return nil, fmt.Errorf("%s: message %q has no \"other\" plural form", name, key)
+			}
+		}
+
+		locale := strings.TrimSuffix(name, path.Ext(name))
+		c.files[locale] = file
+		c.locales = append(c.locales, locale)
+	}
+
+	if _, ok := c.files[sourceLocale]; !ok {
+		return nil, fmt.Errorf("catalog of %s locale not found", sourceLocale)
+	}
+	return c, nil
+}
+
+// Locales returns codes of translated locales in alphabetical order
+func (c *catalog) Locales() []string {
+	return c.locales
+}
+
+// Has reports whether locale is translated
+func (c *catalog) Has(locale string) bool {
+	_, ok := c.files[locale]
+	return ok
+}
+
+// Name returns name of locale's language in itself, e.g. "Русский"
+func (c *catalog) Name(locale string) string {
+	return c.files[locale].Name
+}
+
+// T returns key translated into locale, formatted with args like fmt.Sprintf
+func (c *catalog) T(locale, key string, args ...any) string {
+	text := key
+	if m, ok := c.files[locale].Messages[key]; ok {
+		if m.Text != "" {
+			text = m.Text
+		} else if m.Forms != nil {
+			text = m.Forms["other"]
+		}
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// N returns plural form of key for number n translated into locale. Text is formatted with n followed by args,
+// e.g. N("ru", "%d pages", 3) is "3 страницы".
+func (c *catalog) N(locale, key string, n int, args ...any) string {
+	m, ok := c.files[locale].Messages[key]
+	if !ok || m.Forms == nil {
+		locale = sourceLocale
+		m = c.files[sourceLocale].Messages[key]
+	}
+
+	text := key
+	if m.Forms != nil {
+		text = m.Forms["other"]
+		if form, ok := m.Forms[pluralForm(locale, n)]; ok {
+			text = form
+		}
+	}
+	return fmt.Sprintf(text, append([]any{n}, args...)...)
+}
+
+// pluralForm returns CLDR plural category of integer n in language of locale
+func pluralForm(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch strings.SplitN(locale, "-", 2)[0] {
+	case "ru", "uk":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// Match returns translated locale the client prefers most in Accept-Language header, or "" if there is none.
+// Regional variants fall back to the language, e.g. "ru-RU" matches "ru".
+func (c *catalog) Match(acceptLanguage string) string {
+	type tag struct {
+		locale string
+		q      float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if locale == "" || locale == "*" || q <= 0 {
+			continue
+		}
+		tags = append(tags, tag{strings.ToLower(locale), q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if c.Has(t.locale) {
+			return t.locale
+		}
+		if language, _, ok := strings.Cut(t.locale, "-"); ok && c.Has(language) {
+			return language
+		}
+	}
+	return ""
+}
+
+type localeContextKey struct{}
+
+// contextWithLocale returns ctx carrying locale of request
+func contextWithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+// localeFromContext returns locale set by contextWithLocale, or "" if there is none
+func localeFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeContextKey{}).(string)
+	return locale
+}
+
+// localePrefixHandler serves paths prefixed with translated locale, e.g. "/ru/admin/users",
+// as the path without prefix in that locale
+type localePrefixHandler struct {
+	next http.Handler
+}
+
+func (h localePrefixHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if locale, rest, ok := splitLocalePrefix(r.URL.Path); ok {
+		r = r.WithContext(contextWithLocale(r.Context(), locale))
+		u := *r.URL
+		u.Path, u.RawPath = rest, ""
+		r.URL = &u
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// splitLocalePrefix splits "/ru/pages/about" into "ru" and "/pages/about" if "ru" is translated locale
+func splitLocalePrefix(p string) (string, string, bool) {
+	locale, rest, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	if !messages.Has(locale) {
+		return "", p, false
+	}
+	return locale, "/" + rest, true
+}
+
+// middlewareLocale picks locale of request from URL prefix, then from locale chosen in language switcher
+// (or saved in profile of user), then from Accept-Language, then DEFAULT_LOCALE
+func (a *App) middlewareLocale(c *gin.Context) {
+	locale := localeFromContext(c.Request.Context())
+	if locale == "" {
+		if chosen, ok := sessions.Default(c).Get("locale").(string); ok && messages.Has(chosen) {
+			locale = chosen
+		}
+	}
+	if locale == "" {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		locale = messages.Match(c.GetHeader("Accept-Language"))
+	}
+	if locale == "" {
+		locale = a.Config.DefaultLocale
+	}
+
+	c.Set("locale", locale)
+	c.Request = c.Request.WithContext(contextWithLocale(c.Request.Context(), locale))
+	c.Header("Content-Language", locale)
+	c.Next()
+}
+
+// requestLocale returns locale picked by middlewareLocale
+func requestLocale(c *gin.Context) string {
+	if locale := c.GetString("locale"); locale != "" {
+		return locale
+	}
+	return sourceLocale
+}
+
+// tr translates key into locale of request
+func tr(c *gin.Context, key string, args ...any) string {
+	return messages.T(requestLocale(c), key, args...)
+}
+
+// trn translates plural key for number n into locale of request
+func trn(c *gin.Context, key string, n int, args ...any) string {
+	return messages.N(requestLocale(c), key, n, args...)
+}
+
+// actionLocale remembers locale chosen in language switcher, for logged in user also in their profile
+func (a *App) actionLocale(c *gin.Context) {
+	locale := c.PostForm("locale")
+	if !messages.Has(locale) {
+		c.String(http.StatusBadRequest, tr(c, "Unknown locale"))
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set("locale", locale)
+	session.Save()
+
+	if user, ok := c.Get("currentUser"); ok {
+		if err := a.Users.SetLocale(c.Request.Context(), user.(User).ID, locale); err != nil {
+			a.Logger.ErrorContext(c.Request.Context(), "Failed to save locale of user", "error", err)
+		}
+	}
+
+	// Back to the page of switcher
+	redirect := c.PostForm("redirect")
+	if redirect == "" {
+		if referer, err := url.Parse(c.Request.Referer()); err == nil && referer.Host == c.Request.Host {
+			redirect = referer.RequestURI()
+		}
+	}
+	if !isLocalPath(redirect) {
+		redirect = "/"
+	}
+	// Prefix of the page the switcher was on would override the chosen locale
+	if _, rest, ok := splitLocalePrefix(redirect); ok {
+		redirect = rest
+	}
+	c.Redirect(http.StatusSeeOther, redirect)
+}
+
+// localeInfo describes locale in language switcher
+type localeInfo struct {
+	Code string
+	Name string
+}
+
+// localeFuncs returns fm with template funcs translating into locale:
+// {{t "Logged in as: %s" .Login}}, {{tn "%d pages" (len .pages)}}, {{locale}} and {{locales}}
+func localeFuncs(fm template.FuncMap, locale string) template.FuncMap {
+	funcs := maps.Clone(fm)
+	funcs["t"] = func(key string, args ...any) string {
+		return messages.T(locale, key, args...)
+	}
+	funcs["tn"] = func(key string, n int, args ...any) string {
+		return messages.N(locale, key, n, args...)
+	}
+	funcs["locale"] = func() string {
+		return locale
+	}
+	funcs["locales"] = func() []localeInfo {
+		var locales []localeInfo
+		for _, code := range messages.Locales() {
+			locales = append(locales, localeInfo{Code: code, Name: messages.Name(code)})
+		}
+		return locales
+	}
+	return funcs
+}
+
+// localizedHTMLRender holds templates built for each locale, so that "t" func translates without passing
+// locale around. Templates are named "<locale>/<name>", see renderHTML.
+type localizedHTMLRender map[string]render.HTMLRender
+
+func (r localizedHTMLRender) Instance(name string, data any) render.Render {
+	locale, name, _ := strings.Cut(name, "/")
+	renders, ok := r[locale]
+	if !ok {
+		panic(fmt.Sprintf("template %q has no locale prefix", locale+"/"+name))
+	}
+	return renders.Instance(name, data)
+}
+
+// renderHTML renders template name in locale of request
+func renderHTML(c *gin.Context, code int, name string, data any) {
+	c.HTML(code, requestLocale(c)+"/"+name, data)
+}
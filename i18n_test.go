@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCatalog(t *testing.T) {
+	for _, tt := range []struct {
+		got, want string
+	}{
+		{messages.T("ru", "User was added."), "Пользователь добавлен."},
+		{messages.T("ru", "Logged in as: %s", "admin"), "Вы вошли как: admin"},
+		{messages.T("en", "User was added."), "User was added."},
+		{messages.T("en", "Log in"), "Login"},
+		// Missing translations are shown in English
+		{messages.T("ru", "Not translated %d", 1), "Not translated 1"},
+		{messages.N("en", "%d pages", 1), "1 page"},
+		{messages.N("en", "%d pages", 0), "0 pages"},
+		{messages.N("ru", "%d pages", 1), "1 страница"},
+		{messages.N("ru", "%d pages", 3), "3 страницы"},
+		{messages.N("ru", "%d pages", 5), "5 страниц"},
+		{messages.N("ru", "%d pages", 11), "11 страниц"},
+		{messages.N("ru", "%d pages", 21), "21 страница"},
+		{messages.N("ru", "%d pages", 112), "112 страниц"},
+		{messages.N("ru", "%d users", 24), "24 пользователя"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, tt.got)
+		}
+	}
+}
+
+func TestCatalogMatch(t *testing.T) {
+	for header, want := range map[string]string{
+		"ru":                        "ru",
+		"ru-RU,ru;q=0.9,en;q=0.8":   "ru",
+		"de-DE, en;q=0.5, ru;q=0.7": "ru",
+		"en-US,en;q=0.9":            "en",
+		"de, ru;q=0":                "",
+		"*":                         "",
+		"":                          "",
+	} {
+		if got := messages.Match(header); got != want {
+			t.Errorf("%q: expected %q, got %q", header, want, got)
+		}
+	}
+}
+
+// Every message of templates and handlers must be translated, so that pages don't mix languages
+func TestCatalogTranslatesMessages(t *testing.T) {
+	keyRe := regexp.MustCompile(`\{\{tn? "((?:[^"\\]|\\.)*)"|\btrn?\(c, "((?:[^"\\]|\\.)*)"|validationError\(c, "([^"]*)", "((?:[^"\\]|\\.)*)"`)
+
+	files, _ := filepath.Glob("templates/*/*.html")
+	more, _ := filepath.Glob("templates/*/*/*.html")
+	goFiles, _ := filepath.Glob("*.go")
+	for _, name := range append(append(files, more...), goFiles...) {
+		// Test tools are for developers and stay in English
+		if name == "templates/public/tools.html" {
+			continue
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range keyRe.FindAllStringSubmatch(string(content), -1) {
+			for _, key := range m[1:] {
+				if key == "" {
+					continue
+				}
+				key, err := strconv.Unquote(`"` + key + `"`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, locale := range messages.Locales() {
+					if _, ok := messages.files[locale].Messages[key]; !ok && locale != sourceLocale {
+						t.Errorf("%s: %q is not translated into %s", name, key, locale)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLocaleNegotiation(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+
+	get := func(path, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		return tc.do(req)
+	}
+
+	w := get("/login", "")
+	assertContains(t, w, `<html lang="en">`)
+	assertContains(t, w, "<h1>Login</h1>")
+
+	w = get("/login", "ru-RU,ru;q=0.9,en;q=0.8")
+	assertContains(t, w, `<html lang="ru">`)
+	assertContains(t, w, "<h1>Войти</h1>")
+	if got := w.Header().Get("Content-Language"); got != "ru" {
+		t.Fatalf("expected Content-Language ru, got %q", got)
+	}
+
+	// URL prefix wins over Accept-Language
+	w = get("/en/login", "ru")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<h1>Login</h1>")
+	assertContains(t, get("/ru/login", "en"), "<h1>Войти</h1>")
+	assertContains(t, get("/ru", "en"), "<h1>Главная</h1>")
+
+	// Language switcher wins over Accept-Language and goes back to the page, without prefix of old locale
+	req := httptest.NewRequest(http.MethodPost, "/locale", strings.NewReader("locale=ru"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", "http://example.com/en/login")
+	w = tc.do(req)
+	assertRedirect(t, w, "/login")
+	assertContains(t, get("/login", "en"), "<h1>Войти</h1>")
+	assertContains(t, get("/en/login", "ru"), "<h1>Login</h1>")
+
+	assertStatus(t, tc.post("/locale", url.Values{"locale": {"xx"}}), http.StatusBadRequest)
+}
+
+// Template locale comes from request, not from response writer, which other middlewares may wrap or replace
+func TestRenderHTMLLocale(t *testing.T) {
+	a := newTestApp(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.HTMLRender = a.Renderer
+	router.GET("/", func(c *gin.Context) {
+		c.Set("locale", c.Query("locale"))
+		renderHTML(c, http.StatusOK, "public/login.html", gin.H{})
+	})
+
+	for locale, heading := range map[string]string{"ru": "<h1>Войти</h1>", "en": "<h1>Login</h1>", "": "<h1>Login</h1>"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?locale="+locale, nil))
+		assertStatus(t, w, http.StatusOK)
+		assertContains(t, w, heading)
+	}
+}
+
+func TestLocaleUserPreference(t *testing.T) {
+	a := newTestApp(t)
+	user := createUser(t, a, "admin")
+	tc := loginAs(t, a, user)
+
+	assertRedirect(t, tc.post("/locale", url.Values{"locale": {"ru"}, "redirect": {"/admin/users"}}), "/admin/users")
+	saved, err := a.Users.Find(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Locale != "ru" {
+		t.Fatalf("expected locale to be saved in profile, got %q", saved.Locale)
+	}
+
+	// Another browser gets the locale on login
+	tc = loginAs(t, a, user)
+	w := tc.get("/admin/users")
+	assertContains(t, w, "Вы вошли как: admin")
+	assertContains(t, w, "1 пользователь")
+}
+
+// recordingUserRepository keeps locales set by handlers instead of saving them
+type recordingUserRepository struct {
+	UserRepository
+	locales map[uint]string
+}
+
+func (r *recordingUserRepository) SetLocale(ctx context.Context, id uint, locale string) error {
+	r.locales[id] = locale
+	return nil
+}
+
+// Locale of user is saved through repository of app
+func TestLocaleUserPreferenceRepository(t *testing.T) {
+	a := newTestApp(t)
+	user := createUser(t, a, "admin")
+	users := &recordingUserRepository{UserRepository: a.Users, locales: map[uint]string{}}
+	a.Users = users
+	tc := loginAs(t, a, user)
+
+	assertRedirect(t, tc.post("/locale", url.Values{"locale": {"ru"}, "redirect": {"/admin/users"}}), "/admin/users")
+	if users.locales[user.ID] != "ru" {
+		t.Fatalf("expected locale to be set through repository, got %v", users.locales)
+	}
+	var saved User
+	if err := a.DB.First(&saved, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Locale != "" {
+		t.Fatalf("expected locale not to be written past repository, got %q", saved.Locale)
+	}
+}
+
+func TestTranslatedValidationErrors(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	w := tc.post("/ru/admin/users/create", url.Values{"login": {"ab"}, "password": {"secret"}})
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "[Ошибка проверки] Логин: Слишком короткое значение")
+
+	w = tc.post("/admin/users/create", url.Values{"login": {"ab"}, "password": {"secret"}})
+	assertContains(t, w, "[Validation error] Login: Field is too short")
+
+	w = tc.post("/ru/admin/categories/create", url.Values{"name": {"News"}, "slug": {"Bad slug"}})
+	assertContains(t, w, `[Ошибка проверки] Адрес: Допустимы только строчные латинские буквы, цифры и &#34;-&#34;`)
+
+	// Flashes are translated into locale of request that added them
+	w = tc.post("/ru/admin/users/create", url.Values{"login": {"editor"}, "password": {"secret"}})
+	assertContains(t, tc.follow(w), "Пользователь добавлен.")
+}
+
+// JSON errors are translated like HTML ones
+func TestTranslatedJSONErrors(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertContains(t, tc.postJSON("/ru/admin/users/999/update", url.Values{"version": {"1"}}), `"error":"Пользователь не найден"`)
+	assertContains(t, tc.postJSON("/ru/admin/pages/999/update", url.Values{"version": {"1"}}), `"error":"Страница не найдена"`)
+	assertContains(t, tc.getJSON("/ru/admin/pages/999/translations/xx"), `"error":"Неизвестный язык"`)
+	assertContains(t, tc.getJSON("/admin/pages/999/translations/xx"), `"error":"Unknown locale"`)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Widths of responsive variants used in srcset. Variants are generated on first request and kept in media storage.
+var imageVariantWidths = []int{320, 640, 1280}
+
+// JPEG quality for re-encoded originals and variants
+const imageJPEGQuality = 90
+
+// Largest image (width × height) that is decoded. Decoded image takes 4 bytes per pixel or more, so small file
+// declaring huge size could otherwise take all memory.
+const imageMaxPixels = 50_000_000
+
+// imageVariantsMu serializes variant generation so the same variant is not generated twice concurrently
+var imageVariantsMu sync.Mutex
+
+// isResizableImage reports whether variants can be generated for MIME type
+func isResizableImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// imageVariantKey returns storage key of variant with given width
+func imageVariantKey(key string, width int) string {
+	return key + ".w" + strconv.Itoa(width)
+}
+
+// imageVariantMimeType returns MIME type variants of the source type are encoded to.
+// There is no pure Go WebP encoder, so WebP variants are JPEG. GIF variants are PNG of the first frame.
+func imageVariantMimeType(mimeType string) string {
+	if mimeType == "image/png" || mimeType == "image/gif" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+func encodeImage(w io.Writer, img image.Image, mimeType string) error {
+	switch mimeType {
+	case "image/png":
+		return png.Encode(w, img)
+	case "image/gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: imageJPEGQuality})
+	}
+}
+
+// decodeImageConfig reads size of image from r without decoding pixels, and fails for images larger than imageMaxPixels
+func decodeImageConfig(r io.Reader) (image.Config, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return config, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return config, errors.New("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > imageMaxPixels {
+		return config, fmt.Errorf("image is too large: %d×%d pixels, at most %d megapixels are allowed", config.Width, config.Height, imageMaxPixels/1_000_000)
+	}
+	return config, nil
+}
+
+// jpegExifOrientation returns EXIF orientation (1-8) of JPEG data and whether data has EXIF at all
+func jpegExifOrientation(data []byte) (int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1, false
+	}
+
+	// Walk JPEG segments until APP1 with EXIF or start of scan
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1, false
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1, false
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if size < 2 || i+2+size > len(data) {
+			return 1, false
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:]), true
+		}
+		i += 2 + size
+	}
+
+	return 1, false
+}
+
+// exifOrientation reads orientation tag from IFD0 of TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation rotates and flips image so it looks as EXIF orientation says
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var out *image.NRGBA
+	if orientation >= 5 {
+		out = image.NewNRGBA(image.Rect(0, 0, h, w))
+	} else {
+		out = image.NewNRGBA(image.Rect(0, 0, w, h))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return out
+}
+
+// normalizeJPEG applies EXIF orientation and strips metadata (EXIF camera data and GPS location, XMP, IPTC, comments).
+// Rotated photos are re-encoded, which drops all metadata. Others keep their pixels as they are, see stripJPEGMetadata.
+func normalizeJPEG(data []byte) ([]byte, error) {
+	orientation, _ := jpegExifOrientation(data)
+	if orientation == 1 {
+		return stripJPEGMetadata(data)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, applyOrientation(img, orientation), &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jpegKeptSegment reports whether APPn segment is needed to show JPEG correctly: JFIF header, ICC color profile
+// and Adobe color transform. Other APPn segments (EXIF, XMP, IPTC and vendor data) and comments are metadata.
+func jpegKeptSegment(marker byte, segment []byte) bool {
+	switch marker {
+	case 0xE0:
+		return bytes.HasPrefix(segment, []byte("JFIF\x00")) || bytes.HasPrefix(segment, []byte("JFXX\x00"))
+	case 0xE2:
+		return bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00"))
+	case 0xEE:
+		return bytes.HasPrefix(segment, []byte("Adobe"))
+	}
+	return false
+}
+
+// stripJPEGMetadata removes metadata segments before start of scan, image data is kept as it is
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+
+	out := append([]byte{}, data[:2]...)
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		marker := data[i+1]
+		// Markers may be preceded by fill bytes
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// Scan data has no length, the rest of file is copied
+		if marker == 0xDA {
+			return append(out, data[i:]...), nil
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) || end < i+4 {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		isMetadata := (marker >= 0xE0 && marker <= 0xEF && !jpegKeptSegment(marker, data[i+4:end])) || marker == 0xFE
+		if !isMetadata {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// PNG chunks with text, EXIF and modification time, which can contain camera details, GPS location or author
+var pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// stripPNGMetadata removes metadata chunks from PNG data, pixels are kept as they are
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	out := append([]byte{}, signature...)
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// WebP VP8X flags telling that file has EXIF and XMP chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebPMetadata removes EXIF and XMP chunks from WebP data, pixels are kept as they are.
+// There is no pure Go WebP encoder, so the file can't be re-encoded like JPEG.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a WebP file")
+	}
+
+	out := append([]byte{}, data[:12]...)
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		// Chunks are padded to even size
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+// stripImageMetadata removes EXIF and other metadata of JPEG, PNG and WebP images, applying EXIF orientation
+// to JPEG. GIF is stored as is.
+func stripImageMetadata(data []byte, mimeType string) ([]byte, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return normalizeJPEG(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/webp":
+		return stripWebPMetadata(data)
+	}
+	return data, nil
+}
+
+// resizeImage scales image down to width keeping aspect ratio
+func resizeImage(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(out, out.Bounds(), img, b, draw.Src, nil)
+	return out
+}
+
+// openImageVariant returns variant of media with given width, generating and storing it on first request
+func openImageVariant(storage MediaStorage, media Media, width int) (io.ReadSeekCloser, time.Time, error) {
+	key := imageVariantKey(media.Key, width)
+
+	if f, modTime, err := storage.Open(key); err == nil {
+		return f, modTime, nil
+	}
+
+	imageVariantsMu.Lock()
+	defer imageVariantsMu.Unlock()
+
+	// Variant could be generated while waiting for lock
+	if f, modTime, err := storage.Open(key); err == nil {
+		return f, modTime, nil
+	}
+
+	src, _, err := storage.Open(media.Key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer src.Close()
+
+	// Files uploaded before the size limit, or put into storage directly, are checked before decoding too
+	if _, err := decodeImageConfig(src); err != nil {
+		return nil, time.Time{}, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, resizeImage(img, width), imageVariantMimeType(media.MimeType)); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if err := storage.Save(key, &buf); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return storage.Open(key)
+}
+
+// isImageVariantWidth reports whether width is one of configured variant widths
+func isImageVariantWidth(width int) bool {
+	for _, w := range imageVariantWidths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteImageVariants removes generated variants of media from storage
+func deleteImageVariants(storage MediaStorage, media Media) {
+	for _, width := range imageVariantWidths {
+		storage.Delete(imageVariantKey(media.Key, width))
+	}
+}
+
+// imageSrcset returns srcset attribute value with variants narrower than the original and the original itself
+func imageSrcset(media Media) string {
+	if !isResizableImage(media.MimeType) || media.Width == 0 {
+		return ""
+	}
+
+	var parts []string
+	for _, width := range imageVariantWidths {
+		if width < media.Width {
+			parts = append(parts, media.URL()+"?w="+strconv.Itoa(width)+" "+strconv.Itoa(width)+"w")
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	parts = append(parts, media.URL()+" "+strconv.Itoa(media.Width)+"w")
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// pngChunk returns PNG chunk with length and CRC
+func pngChunk(typ string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// hugePNG returns valid PNG of width×height pixels declared in header. Its pixel data is missing,
+// which is never noticed if the image is not decoded.
+func hugePNG(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr)...)
+	return append(data, pngChunk("IEND", nil)...)
+}
+
+func TestDecodeImageConfig(t *testing.T) {
+	config, err := decodeImageConfig(bytes.NewReader(testPNG(t, 40, 30)))
+	if err != nil || config.Width != 40 || config.Height != 30 {
+		t.Fatalf("unexpected config %+v: %v", config, err)
+	}
+
+	if _, err := decodeImageConfig(bytes.NewReader(hugePNG(100000, 100000))); err == nil || !strings.Contains(err.Error(), "image is too large") {
+		t.Fatalf("expected huge image to be refused, got %v", err)
+	}
+}
+
+func TestMediaUploadRejectsHugeImage(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	w := uploadMedia(tc, "bomb.png", hugePNG(100000, 100000))
+	assertStatus(t, w, http.StatusBadRequest)
+	assertContains(t, w, "Invalid image: image is too large: 100000×100000 pixels")
+}
+
+// Variants of images put into storage before the limit are not decoded either
+func TestImageVariantRejectsHugeImage(t *testing.T) {
+	a := newTestApp(t)
+
+	media := Media{Key: "bomb.png", Filename: "bomb.png", MimeType: "image/png", Width: 100000, Height: 100000}
+	if err := a.Storage.Save(media.Key, bytes.NewReader(hugePNG(100000, 100000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DB.Create(&media).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, newTestClient(t, a).get(media.URL()+"?w=320"), http.StatusNotFound)
+}
+
+func TestMediaUploadStripsPNGMetadata(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	clean := testPNG(t, 4, 4)
+	// Metadata chunks go after IHDR: signature (8 bytes) and IHDR chunk (25 bytes)
+	data := append([]byte{}, clean[:33]...)
+	data = append(data, pngChunk("tEXt", []byte("GPS\x0055.75,37.61"))...)
+	data = append(data, pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00"))...)
+	data = append(data, clean[33:]...)
+
+	assertRedirect(t, uploadMedia(tc, "photo.png", data), "/admin/media")
+	media := lastMedia(t, a)
+
+	f, _, err := a.Storage.Open(media.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(stored, clean) {
+		t.Fatalf("expected metadata chunks to be removed, got %q", stored)
+	}
+	if media.Size != int64(len(clean)) || media.Width != 4 {
+		t.Fatalf("unexpected media %+v", media)
+	}
+}
+
+// webpChunk returns RIFF chunk padded to even size
+func webpChunk(typ string, data []byte) []byte {
+	chunk := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	webp := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, chunk := range chunks {
+			body = append(body, chunk...)
+		}
+		return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagEXIF | webpFlagXMP | 0x10
+	image := webpChunk("VP8L", []byte("pixels"))
+
+	stripped, err := stripWebPMetadata(webp(webpChunk("VP8X", vp8x), webpChunk("EXIF", []byte("GPS 55.75")), image, webpChunk("XMP ", []byte("<x:xmpmeta/>"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vp8x[0] = 0x10
+	if want := webp(webpChunk("VP8X", vp8x), image); !bytes.Equal(stripped, want) {
+		t.Fatalf("expected %q, got %q", want, stripped)
+	}
+
+	if _, err := stripWebPMetadata([]byte("RIFF\x04\x00\x00\x00WEBPVP8L\xff\x00\x00\x00")); err == nil {
+		t.Fatal("expected truncated chunk to be refused")
+	}
+}
+
+// jpegSegment returns JPEG marker segment with length
+func jpegSegment(marker byte, data string) []byte {
+	return append([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+}
+
+// testJPEG returns JPEG image with segments inserted after SOI
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	icc := jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01profile")
+	clean := testJPEG(t, icc)
+
+	data := testJPEG(t,
+		jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta><exif:GPSLatitude>55,45N</exif:GPSLatitude></x:xmpmeta>"),
+		jpegSegment(0xED, "Photoshop 3.0\x008BIM author"),
+		jpegSegment(0xFE, "taken at home"),
+		icc,
+	)
+	stripped, err := normalizeJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, clean) {
+		t.Fatalf("expected only metadata segments to be removed, got %q", stripped)
+	}
+
+	if _, err := stripJPEGMetadata([]byte("\xff\xd8\xff\xe1\x00\x10Exif")); err == nil {
+		t.Fatal("expected truncated segment to be refused")
+	}
+}
+
+func TestMediaUploadStripsJPEGMetadata(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	// XMP without EXIF, so nothing has to be rotated
+	assertRedirect(t, uploadMedia(tc, "photo.jpg", testJPEG(t, jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<exif:GPSLatitude>55,45N</exif:GPSLatitude>"))), "/admin/media")
+	media := lastMedia(t, a)
+
+	f, _, err := a.Storage.Open(media.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(f)
+	f.Close()
+	if bytes.Contains(stored, []byte("GPSLatitude")) || !bytes.Equal(stored, testJPEG(t)) {
+		t.Fatalf("expected XMP to be removed, got %q", stored)
+	}
+	if media.MimeType != "image/jpeg" || media.Width != 8 {
+		t.Fatalf("unexpected media %+v", media)
+	}
+}
@@ -6,6 +6,20 @@ type UserInput struct {
 }
 
 type PageInput struct {
-	Slug    string `validate:"required"`
-	Content string `validate:"required"`
+	Slug         string `validate:"required"`
+	Content      string `validate:"required"`
+	Title        string `validate:"max=255"`
+	Description  string `validate:"max=500"`
+	CanonicalURL string `validate:"omitempty,url,max=2048"`
+}
+
+type CategoryInput struct {
+	Name string `validate:"required,max=100"`
+	Slug string `validate:"required,max=100"`
+}
+
+type PageTranslationInput struct {
+	Content     string `validate:"required"`
+	Title       string `validate:"max=255"`
+	Description string `validate:"max=500"`
 }
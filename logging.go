@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Queries slower than DB_SLOW_QUERY_THRESHOLD (Go duration, "0" disables) are logged as warnings
+const dbDefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// Header used to receive request ID from proxy and to return it to client
+const requestIDHeader = "X-Request-ID"
+
+// Request IDs received from clients are accepted only if they look like IDs
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// newLogger creates logger of component with level from cfg. Output is JSON unless LOG_FORMAT=text.
+func newLogger(cfg Config, component string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevels[component]}
+
+	var handler slog.Handler
+	if cfg.LogFormat == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	return slog.New(tracingLogHandler{handler}).With("component", component)
+}
+
+// requestID returns ID of request ctx belongs to, or empty string outside of request
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// middlewareRequestID assigns ID to request, taking it from X-Request-ID header if present.
+// The ID is returned in response header and stored in request context.
+func middlewareRequestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !requestIDRe.MatchString(id) {
+		id = newRequestID()
+	}
+
+	c.Set("requestID", id)
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+
+	c.Next()
+}
+
+// middlewareLogRequest logs every request after it's handled
+func (a *App) middlewareLogRequest(c *gin.Context) {
+	start := time.Now()
+	path := c.Request.URL.Path
+
+	c.Next()
+
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	case path == "/healthz" || path == "/readyz":
+		// Probes come every few seconds
+		level = slog.LevelDebug
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", c.GetString("requestID")),
+		slog.String("method", c.Request.Method),
+		slog.String("path", path),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("ip", c.ClientIP()),
+		slog.String("user_agent", c.Request.UserAgent()),
+		slog.Int("size", c.Writer.Size()),
+	}
+	if len(c.Errors) > 0 {
+		attrs = append(attrs, slog.String("errors", c.Errors.String()))
+	}
+
+	a.HTTPLogger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+}
+
+// recoverPanic logs panic of handler and responds with error page containing request ID
+func (a *App) recoverPanic(c *gin.Context, recovered any) {
+	a.HTTPLogger.Error("panic", "request_id", c.GetString("requestID"), "error", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+	c.String(http.StatusInternalServerError, "Internal Server Error\nRequest ID: "+c.GetString("requestID"))
+}
+
+// gormLogger writes gorm logs to db logger. Failed queries are logged as errors, slow queries as warnings,
+// other queries only with debug level.
+type gormLogger struct {
+	logger        *slog.Logger
+	slowThreshold time.Duration
+}
+
+func newGormLogger(logger *slog.Logger, slowThreshold time.Duration) *gormLogger {
+	return &gormLogger{logger: logger, slowThreshold: slowThreshold}
+}
+
+// LogMode is ignored, level is controlled by LOG_LEVEL_DB
+func (l *gormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, args...), "request_id", requestID(ctx))
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, args...), "request_id", requestID(ctx))
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, args...), "request_id", requestID(ctx))
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+
+	var level slog.Level
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "query failed"
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	default:
+		level, msg = slog.LevelDebug, "query"
+	}
+
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("request_id", requestID(ctx)),
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("elapsed", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
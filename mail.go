@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Mail is an email message
+type Mail struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// logMailer writes emails to log instead of sending them, until SMTP delivery is configured
+type logMailer struct {
+	logger *slog.Logger
+}
+
+func newLogMailer(logger *slog.Logger) *logMailer {
+	return &logMailer{logger: logger}
+}
+
+func (m *logMailer) Send(ctx context.Context, mail Mail) error {
+	m.logger.InfoContext(ctx, "Mail", "to", strings.Join(mail.To, ", "), "subject", mail.Subject, "body", mail.Body)
+	return nil
+}
+
+// outboxMailer keeps copies of sent emails so that tests can inspect them, used in test mode
+type outboxMailer struct {
+	next Mailer
+
+	mu   sync.Mutex
+	sent []Mail
+}
+
+func newOutboxMailer(next Mailer) *outboxMailer {
+	return &outboxMailer{next: next}
+}
+
+func (m *outboxMailer) Send(ctx context.Context, mail Mail) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, mail)
+	m.mu.Unlock()
+
+	return m.next.Send(ctx, mail)
+}
+
+// Sent returns emails sent since the outbox was last cleared, oldest first
+func (m *outboxMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail{}, m.sent...)
+}
+
+// Clear empties the outbox
+func (m *outboxMailer) Clear() {
+	m.mu.Lock()
+	m.sent = nil
+	m.mu.Unlock()
+}
+
+// notifyUserCreated tells NOTIFY_EMAIL addresses about new user. Failures are logged and don't break the action.
+func (a *App) notifyUserCreated(c *gin.Context, user User) {
+	if len(a.Config.NotifyEmails) == 0 {
+		return
+	}
+
+	body := fmt.Sprintf("User %s was added", user.Login)
+	if actor, exists := c.Get("currentUser"); exists {
+		body += " by " + actor.(User).Login
+	}
+	body += " at " + a.now().UTC().Format("2006-01-02 15:04:05") + " UTC."
+
+	mail := Mail{To: a.Config.NotifyEmails, Subject: "New user: " + user.Login, Body: body}
+	if err := a.Mailer.Send(c.Request.Context(), mail); err != nil {
+		a.Logger.ErrorContext(c, "Failed to send mail", "request_id", c.GetString("requestID"), "error", err)
+	}
+}
@@ -1,23 +1,20 @@
 package main
 
 import (
+	"context"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/gin-contrib/multitemplate"
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-var db *gorm.DB
-var err error
+// Models whose tables are created by AutoMigrate
+var migratedModels = []interface{}{&User{}, &Media{}, &Category{}, &Tag{}, &Page{}, &PageTranslation{}, &AuditLog{}, &SQLQuery{}, &SavedSQLQuery{}}
 
 // isDocker checks if the program is running inside a Docker container
 func isDocker() bool {
@@ -38,136 +35,140 @@ func isDocker() bool {
 	return false
 }
 
-// TODO: Move DB credentials into .env
-func initDB() {
-	// Connect to the database
-	var pg_host string
-	if isDocker() {
-		pg_host = "postgres"
-	} else {
-		pg_host = "localhost"
-	}
-	dsn := "host=" + pg_host + " user=postgres dbname=appdb password=postgres sslmode=disable"
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
-	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
-	}
+// templateSets returns files of every page template in fsys, keyed by its path (e.g. "admin/users/index.html").
+// Layout and partials come first, the page itself last.
+func templateSets(fsys fs.FS) (map[string][]string, error) {
+	sets := map[string][]string{}
 
+	publicLayouts := []string{"layouts/public.html"}
+	adminLayouts := []string{"layouts/admin.html"}
+	// partials are shared blocks available to admin templates
+	partials, err := fs.Glob(fsys, "partials/*.html")
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
-	}
-
-	// Migrate the schema
-	db.AutoMigrate(&User{}, &Page{})
-}
-
-func seed() {
-	var count int64
-
-	db.Model(&User{}).Count(&count)
-
-	// If there are no users, create sample user
-	if count == 0 {
-		result := db.Create(&User{Login: "admin", Password: "admin"})
-		if result.Error != nil {
-			println(result.Error)
-			panic("Failed to create user")
-		}
-
+		return nil, err
 	}
-}
+	adminLayouts = append(adminLayouts, partials...)
 
-func isTest() bool {
-	return (os.Getenv("TEST") == "1" || os.Getenv("TEST") == "true" || os.Getenv("TEST") == "yes" || os.Getenv("TEST") == "on" || os.Getenv("TEST") == "t")
-}
-
-func loadTemplates(templatesDir string) multitemplate.Renderer {
-	r := multitemplate.NewRenderer()
-
-	// your custom funcs
-	fm := template.FuncMap{
-		"isTest": isTest,
-	}
-
-	// find your layouts
-	publicLayouts, err := filepath.Glob(filepath.Join(templatesDir, "layouts", "public.html"))
-	if err != nil {
-		panic(err)
-	}
-	adminLayouts, err := filepath.Glob(filepath.Join(templatesDir, "layouts", "admin.html"))
-	if err != nil {
-		panic(err)
-	}
-
-	// walk every file under templatesDir
-	err = filepath.Walk(templatesDir, func(path string, info os.FileInfo, err error) error {
+	// walk every file of fsys
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if d.IsDir() {
 			return nil
 		}
 
-		// skip your layout files themselves
-		relToLayouts := filepath.Join("layouts")
-		if strings.HasPrefix(path, filepath.Join(templatesDir, relToLayouts)) {
+		// skip layouts and partials themselves
+		if strings.HasPrefix(name, "layouts/") || strings.HasPrefix(name, "partials/") {
 			return nil
 		}
 
 		// only handle html files
-		if !strings.HasSuffix(path, ".html") {
+		if !strings.HasSuffix(name, ".html") {
 			return nil
 		}
 
-		// compute the name you want to render by stripping the base dir
-		relPath, err := filepath.Rel(templatesDir, path)
-		if err != nil {
-			return err
-		}
-		// turn Windows \ into forward slash
-		name := filepath.ToSlash(relPath)
-
 		// pick which layout slice applies
 		var layoutSlice []string
-		if strings.HasPrefix(relPath, "admin/") {
+		if strings.HasPrefix(name, "admin/") {
 			layoutSlice = adminLayouts
-		} else if strings.HasPrefix(relPath, "public/") {
+		} else if strings.HasPrefix(name, "public/") {
 			layoutSlice = publicLayouts
 		}
 
-		// finally register it
-		files := append(layoutSlice, path)
-		r.AddFromFilesFuncs(name, fm, files...)
+		sets[name] = append(append([]string{}, layoutSlice...), name)
 		return nil
 	})
+	return sets, err
+}
+
+// loadTemplates builds template of every page in fsys together with its layout, once for each locale.
+// Besides fm, templates get "t" and "tn" funcs translating into their locale, see localeFuncs.
+func loadTemplates(fsys fs.FS, fm template.FuncMap) localizedHTMLRender {
+	sets, err := templateSets(fsys)
 	if err != nil {
 		panic(err)
 	}
 
-	return r
+	renders := localizedHTMLRender{}
+	for _, locale := range messages.Locales() {
+		funcs := localeFuncs(fm, locale)
+		r := multitemplate.New()
+		for name, files := range sets {
+			r.AddFromFSFuncs(name, funcs, fsys, files...)
+		}
+		renders[locale] = r
+	}
+	return renders
 }
 
-func setupGin() {
-    // Create a new Gin router
-	router := gin.Default()
+func main() {
+	// Cancelled on SIGINT/SIGTERM to shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	store := cookie.NewStore([]byte("secret"))
-	router.Use(sessions.Sessions("mysession", store))
+	cfg := loadConfig()
 
-	router.HTMLRender = loadTemplates("./templates")
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
-	setupRoutes(router)
+	db, err := openDB(cfg)
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
 
-	// Run the server
-	router.Run(":8080")
-}
+	app, err := newApp(cfg, db)
+	if err != nil {
+		slog.Error("Failed to initialize app", "error", err)
+		os.Exit(1)
+	}
+	defer app.Close()
 
-func main() {
-	initDB()
+	// Messages of libraries using standard log package go to app logger
+	slog.SetDefault(app.Logger)
 
-	seed()
+	// "generate" command fills database with fake data instead of starting server
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		opts, err := parseGenerateOptions(os.Args[2:], os.Stderr)
+		if err != nil {
+			os.Exit(2)
+		}
+		if err := generateData(ctx, app.DB, opts); err != nil {
+			app.Logger.Error("Failed to generate data", "error", err)
+			os.Exit(1)
+		}
+		app.Logger.Info("Generated data", "seed", opts.Seed, "users", opts.Users, "pages", opts.Pages)
+		return
+	}
+
+	if err := app.seed(ctx); err != nil {
+		app.Logger.Error("Failed to seed database", "error", err)
+		os.Exit(1)
+	}
+
+	trashPurgerDone := app.startTrashPurger(ctx)
+
+	serverErr := app.runServer(ctx)
+	if serverErr != nil {
+		app.Logger.Error("Server failed", "error", serverErr)
+	}
+
+	// Stop background jobs before closing DB they use
+	stop()
+	<-trashPurgerDone
+
+	// Non-zero exit code tells Docker, systemd and CI that server failed (e.g. port is in use) instead of
+	// being shut down. os.Exit skips deferred calls, so they are made here.
+	if serverErr != nil {
+		app.Close()
+		shutdownTracing(context.Background())
+		os.Exit(1)
+	}
 
-	setupGin()
+	app.Logger.Info("Stopped")
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Password of users created by createUser
+const testPassword = "secret"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testConfig returns config of app under test: /tools enabled, media in temp dir, only errors logged
+func testConfig(t *testing.T) Config {
+	cfg := Config{
+		Test:              true,
+		DefaultLocale:     sourceLocale,
+		TemplatesDir:      "./templates",
+		StaticDir:         "./static",
+		MediaDir:          t.TempDir(),
+		MediaMaxSize:      mediaDefaultMaxSize,
+		FixturesDir:       fixturesDefaultDir,
+		SQLConsoleTimeout: sqlConsoleDefaultTimeout,
+		SQLConsoleMaxRows: sqlConsoleDefaultMaxRows,
+		TrashRetention:    trashDefaultRetention,
+		SessionLifetime:   sessionDefaultLifetime,
+		LogFormat:         "text",
+		LogLevels:         map[string]slog.Level{},
+	}
+	for _, component := range logComponents {
+		cfg.LogLevels[component] = slog.LevelError
+	}
+	return cfg
+}
+
+// openTestDB returns migrated database dropped when test ends.
+// TEST_DATABASE_DRIVER selects dialect ("sqlite" by default). SQLite database is a file in temp dir,
+// for Postgres and MySQL every test creates its own schema or database on server from TEST_DATABASE_DSN.
+func openTestDB(t *testing.T, cfg Config) *gorm.DB {
+	t.Helper()
+
+	gormConfig := &gorm.Config{Logger: newGormLogger(newLogger(cfg, "db"), 0)}
+
+	var db *gorm.DB
+	var err error
+	switch driver := envString("TEST_DATABASE_DRIVER", "sqlite"); driver {
+	case "sqlite":
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err = gorm.Open(sqlite.Open(path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"), gormConfig)
+	case "postgres":
+		db, err = openTestSchema(t, os.Getenv("TEST_DATABASE_DSN"), gormConfig)
+	case "mysql":
+		db, err = openTestMySQLDatabase(t, os.Getenv("TEST_DATABASE_DSN"), gormConfig)
+	default:
+		t.Fatalf("unknown TEST_DATABASE_DRIVER %q", driver)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testDatabaseName returns random name of throwaway schema or database
+func testDatabaseName() string {
+	return "test_" + newRequestID()[:16]
+}
+
+// openTestSchema creates throwaway Postgres schema and connects to it
+func openTestSchema(t *testing.T, dsn string, gormConfig *gorm.Config) (*gorm.DB, error) {
+	admin, err := gorm.Open(postgres.Open(dsn), gormConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := testDatabaseName()
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Error(err)
+		}
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return gorm.Open(postgres.Open(dsn+" search_path="+schema), gormConfig)
+}
+
+// openTestMySQLDatabase creates throwaway MySQL database and connects to it
+func openTestMySQLDatabase(t *testing.T, dsn string, gormConfig *gorm.Config) (*gorm.DB, error) {
+	admin, err := gorm.Open(mysql.Open(dsn), gormConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	mysqlConfig, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	mysqlConfig.DBName = testDatabaseName()
+	mysqlConfig.ParseTime = true
+
+	if err := admin.Exec("CREATE DATABASE " + mysqlConfig.DBName).Error; err != nil {
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP DATABASE " + mysqlConfig.DBName).Error; err != nil {
+			t.Error(err)
+		}
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return gorm.Open(mysql.Open(mysqlConfig.FormatDSN()), gormConfig)
+}
+
+// newTestApp creates app with its own database and media storage
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	cfg := testConfig(t)
+	a, err := newApp(cfg, openTestDB(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// testClient sends requests to app in-process and keeps session cookie between them like a browser
+type testClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newTestClient(t *testing.T, a *App) *testClient {
+	return &testClient{t: t, handler: a.Router(), cookies: map[string]*http.Cookie{}}
+}
+
+func (tc *testClient) do(req *http.Request) *httptest.ResponseRecorder {
+	tc.t.Helper()
+
+	for _, cookie := range tc.cookies {
+		req.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	tc.handler.ServeHTTP(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(tc.cookies, cookie.Name)
+		} else {
+			tc.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+func (tc *testClient) get(path string) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	return tc.do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// getJSON requests path as API client that wants JSON response
+func (tc *testClient) getJSON(path string) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept", "application/json")
+	return tc.do(req)
+}
+
+func (tc *testClient) post(path string, form url.Values) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return tc.do(req)
+}
+
+// postJSON posts form as API client that wants JSON response
+func (tc *testClient) postJSON(path string, form url.Values) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return tc.do(req)
+}
+
+// follow checks that w redirects and requests the redirect target
+func (tc *testClient) follow(w *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	if w.Code != http.StatusSeeOther && w.Code != http.StatusFound {
+		tc.t.Fatalf("expected redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	return tc.get(w.Header().Get("Location"))
+}
+
+// createUser saves user with testPassword
+func createUser(t *testing.T, a *App, login string) User {
+	t.Helper()
+	user := User{Login: login, Password: testPassword}
+	if err := a.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createPage saves page with tags
+func createPage(t *testing.T, a *App, page Page, tags ...string) Page {
+	t.Helper()
+	if page.Content == "" {
+		page.Content = "Content of " + page.Slug
+	}
+	var pageTags []Tag
+	for _, name := range tags {
+		pageTags = append(pageTags, Tag{Name: name})
+	}
+	if err := a.Pages.Create(context.Background(), &page, pageTags); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// loginAs returns client signed in as user created by createUser
+func loginAs(t *testing.T, a *App, user User) *testClient {
+	t.Helper()
+	tc := newTestClient(t, a)
+	w := tc.post("/login", url.Values{"login": {user.Login}, "password": {testPassword}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("login as %s failed: %d %s", user.Login, w.Code, w.Body.String())
+	}
+	return tc
+}
+
+// loginAsAdmin creates user "admin" and signs in as it
+func loginAsAdmin(t *testing.T, a *App) *testClient {
+	t.Helper()
+	return loginAs(t, a, createUser(t, a, "admin"))
+}
+
+// assertStatus fails test if response has other status code
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, code int) {
+	t.Helper()
+	if w.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, w.Code, w.Body.String())
+	}
+}
+
+// assertRedirect fails test if response doesn't redirect to location
+func assertRedirect(t *testing.T, w *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	assertStatus(t, w, http.StatusSeeOther)
+	if got := w.Header().Get("Location"); got != location {
+		t.Fatalf("expected redirect to %s, got %s", location, got)
+	}
+}
+
+// assertContains fails test if response body doesn't contain s
+func assertContains(t *testing.T, w *httptest.ResponseRecorder, s string) {
+	t.Helper()
+	if !strings.Contains(w.Body.String(), s) {
+		t.Fatalf("expected body to contain %q, got: %s", s, w.Body.String())
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Default limit for uploaded files, can be changed with MEDIA_MAX_SIZE (bytes)
+const mediaDefaultMaxSize = 10 << 20
+
+// Shortcode used to embed media into page content: [media:ID]
+var mediaShortcodeRe = regexp.MustCompile(`\[media:(\d+)\]`)
+
+// Sniffed MIME types that can be uploaded. HTML, SVG and other scriptable types are not allowed, neither are
+// text and unrecognized binary files, which could be anything.
+var mediaAllowedTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"audio/",
+	"video/",
+	"application/pdf",
+	"application/zip",
+	"application/x-gzip",
+}
+
+func mediaTypeAllowed(mimeType string) bool {
+	for _, allowed := range mediaAllowedTypes {
+		if strings.HasPrefix(mimeType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImage reports whether media can be shown with <img>
+func (m Media) IsImage() bool {
+	return strings.HasPrefix(m.MimeType, "image/")
+}
+
+// URL returns public URL of media
+func (m Media) URL() string {
+	return "/media/" + m.Key
+}
+
+// Shortcode returns text that embeds media into page content
+func (m Media) Shortcode() string {
+	return "[media:" + strconv.FormatUint(uint64(m.ID), 10) + "]"
+}
+
+// newMediaKey generates random storage key keeping a sanitized extension of the original file name
+func newMediaKey(filename string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "." {
+		ext = ""
+	}
+	for _, r := range strings.TrimPrefix(ext, ".") {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			ext = ""
+			break
+		}
+	}
+
+	return hex.EncodeToString(buf) + ext, nil
+}
+
+// allMedia returns media newest first, as shown in media library and in the media dialog of page forms
+func (a *App) allMedia(c *gin.Context) []Media {
+	var media []Media
+	a.requestDB(c).Order("id desc").Find(&media)
+	return media
+}
+
+// renderPageContent escapes page content and replaces media shortcodes with <img> or download links
+func (a *App) renderPageContent(c *gin.Context, content string) template.HTML {
+	db := a.requestDB(c)
+	escaped := template.HTMLEscapeString(content)
+
+	return template.HTML(mediaShortcodeRe.ReplaceAllStringFunc(escaped, func(code string) string {
+		id := mediaShortcodeRe.FindStringSubmatch(code)[1]
+
+		var m Media
+		if err := db.First(&m, id).Error; err != nil {
+			return code
+		}
+
+		url := template.HTMLEscapeString(m.URL())
+		name := template.HTMLEscapeString(m.Filename)
+		if m.IsImage() {
+			img := `<img src="` + url + `" alt="` + name + `"`
+			if m.Width > 0 && m.Height > 0 {
+				img += ` width="` + strconv.Itoa(m.Width) + `" height="` + strconv.Itoa(m.Height) + `"`
+			}
+			if srcset := imageSrcset(m); srcset != "" {
+				img += ` srcset="` + template.HTMLEscapeString(srcset) + `" sizes="(max-width: ` + strconv.Itoa(m.Width) + `px) 100vw, ` + strconv.Itoa(m.Width) + `px"`
+			}
+			return img + ` loading="lazy">`
+		}
+		return `<a href="` + url + `" download="` + name + `">` + name + `</a>`
+	}))
+}
+
+func (a *App) actionAdminMediaIndex(c *gin.Context) {
+	renderHTML(c, http.StatusOK, "admin/media/index.html", addFlashesAndUser(c, &gin.H{"media": a.allMedia(c), "maxSize": a.Config.MediaMaxSize}))
+}
+
+// saveUploadedMedia validates uploaded file, puts it into storage and creates Media record
+func (a *App) saveUploadedMedia(c *gin.Context) (*Media, error) {
+	db := a.requestDB(c)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errors.New("File is too large")
+		}
+		return nil, errors.New("File is required")
+	}
+
+	if fileHeader.Size > a.Config.MediaMaxSize {
+		return nil, errors.New("File is too large")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Never trust Content-Type sent by the browser
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	mimeType := http.DetectContentType(head)
+	if !mediaTypeAllowed(mimeType) {
+		return nil, errors.New("File type is not allowed: " + mimeType)
+	}
+
+	key, err := newMediaKey(fileHeader.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	media := Media{
+		Key:      key,
+		Filename: filepath.Base(fileHeader.Filename),
+		MimeType: mimeType,
+		Size:     fileHeader.Size,
+	}
+
+	content := io.MultiReader(bytes.NewReader(head), file)
+
+	if isResizableImage(mimeType) {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, err
+		}
+
+		// Size is checked before decoding pixels
+		if _, err := decodeImageConfig(bytes.NewReader(data)); err != nil {
+			return nil, errors.New("Invalid image: " + err.Error())
+		}
+
+		if data, err = stripImageMetadata(data, mimeType); err != nil {
+			return nil, errors.New("Invalid image: " + err.Error())
+		}
+
+		// Orientation of JPEG may swap width and height
+		config, err := decodeImageConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.New("Invalid image: " + err.Error())
+		}
+
+		media.Width = config.Width
+		media.Height = config.Height
+		media.Size = int64(len(data))
+		content = bytes.NewReader(data)
+	}
+
+	if err := a.Storage.Save(key, content); err != nil {
+		return nil, err
+	}
+
+	if err := db.Create(&media).Error; err != nil {
+		a.Storage.Delete(key)
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+func (a *App) actionAdminMediaCreate(c *gin.Context) {
+	// Leave some room for multipart headers
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, a.Config.MediaMaxSize+1<<20)
+
+	media, err := a.saveUploadedMedia(c)
+	if err != nil {
+		renderHTML(c, http.StatusBadRequest, "admin/media/index.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "media": a.allMedia(c), "maxSize": a.Config.MediaMaxSize}))
+		return
+	}
+
+	a.audit(c, "create", "media", media.ID, nil, media)
+
+	session := sessions.Default(c)
+	session.AddFlash(tr(c, "Media was uploaded."))
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/media")
+}
+
+func (a *App) actionAdminMediaDestroy(c *gin.Context) {
+	db := a.requestDB(c)
+
+	id := c.Param("id")
+	session := sessions.Default(c)
+
+	var media Media
+	if err := db.First(&media, id).Error; err != nil {
+		session.AddFlash(tr(c, "Media not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/media")
+		return
+	}
+
+	if err := db.Delete(&media).Error; err != nil {
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/media")
+		return
+	}
+
+	a.audit(c, "delete", "media", media.ID, media, nil)
+
+	deleteImageVariants(a.Storage, media)
+	if err := a.Storage.Delete(media.Key); err != nil {
+		session.AddFlash(tr(c, "Media was deleted, but file could not be removed: %v", err))
+	} else {
+		session.AddFlash(tr(c, "Media was deleted."))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/media")
+}
+
+// actionPublicMedia serves uploaded file. Range requests and conditional requests are handled by http.ServeContent.
+func (a *App) actionPublicMedia(c *gin.Context) {
+	db := a.requestDB(c)
+
+	var media Media
+	if err := db.Where(&Media{Key: c.Param("key")}).First(&media).Error; err != nil {
+		c.String(http.StatusNotFound, "Media not found")
+		return
+	}
+
+	mimeType := media.MimeType
+
+	var f io.ReadSeekCloser
+	var modTime time.Time
+	var err error
+	// ?w=640 requests resized variant of image
+	if w := c.Query("w"); w != "" && isResizableImage(media.MimeType) {
+		width, convErr := strconv.Atoi(w)
+		if convErr != nil || !isImageVariantWidth(width) || width >= media.Width {
+			c.String(http.StatusNotFound, "Media not found")
+			return
+		}
+		f, modTime, err = openImageVariant(a.Storage, media, width)
+		mimeType = imageVariantMimeType(media.MimeType)
+	} else {
+		f, modTime, err = a.Storage.Open(media.Key)
+	}
+	if err != nil {
+		c.String(http.StatusNotFound, "Media not found")
+		return
+	}
+	defer f.Close()
+
+	disposition := "attachment"
+	if media.IsImage() {
+		disposition = "inline"
+	}
+
+	// Keys are random and files are never changed, so they can be cached forever
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": media.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(c.Writer, c.Request, media.Filename, modTime, f)
+}
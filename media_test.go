@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// uploadMedia posts file to media library
+func uploadMedia(tc *testClient, filename string, data []byte) *httptest.ResponseRecorder {
+	tc.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/media/create", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return tc.do(req)
+}
+
+// testPNG returns PNG image of given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// lastMedia returns the latest uploaded media
+func lastMedia(t *testing.T, a *App) Media {
+	t.Helper()
+	var media Media
+	if err := a.DB.Order("id desc").First(&media).Error; err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+func TestMediaUpload(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	w := uploadMedia(tc, "Photo.PNG", testPNG(t, 40, 30))
+	assertRedirect(t, w, "/admin/media")
+	assertContains(t, tc.follow(w), "Media was uploaded.")
+
+	media := lastMedia(t, a)
+	if media.MimeType != "image/png" || media.Filename != "Photo.PNG" || media.Width != 40 || media.Height != 30 {
+		t.Fatalf("unexpected media: %+v", media)
+	}
+	if !strings.HasSuffix(media.Key, ".png") {
+		t.Fatalf("expected key to keep extension, got %q", media.Key)
+	}
+
+	w = newTestClient(t, a).get(media.URL())
+	assertStatus(t, w, http.StatusOK)
+	if w.Header().Get("Content-Type") != "image/png" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	assertStatus(t, newTestClient(t, a).get("/media/missing.png"), http.StatusNotFound)
+}
+
+// Type is sniffed from content, file name and Content-Type sent by browser are ignored
+func TestMediaUploadSniffsType(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	for name, tt := range map[string]struct {
+		filename string
+		data     []byte
+		sniffed  string
+	}{
+		"html":    {"page.png", []byte("<html><script>alert(1)</script></html>"), "text/html"},
+		"svg":     {"image.svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), "text/xml"},
+		"text":    {"notes.txt", []byte("just some notes"), "text/plain"},
+		"unknown": {"data.bin", []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff}, "application/octet-stream"},
+	} {
+		w := uploadMedia(tc, tt.filename, tt.data)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "File type is not allowed: "+tt.sniffed) {
+			t.Errorf("%s: expected upload to be rejected as %s, got %d: %s", name, tt.sniffed, w.Code, w.Body.String())
+		}
+	}
+
+	var count int64
+	a.DB.Model(&Media{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no media saved, got %d", count)
+	}
+
+	assertRedirect(t, uploadMedia(tc, "doc.bin", []byte("%PDF-1.4\n%EOF")), "/admin/media")
+	if media := lastMedia(t, a); media.MimeType != "application/pdf" {
+		t.Fatalf("expected PDF, got %q", media.MimeType)
+	}
+}
+
+func TestMediaShortcode(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+
+	assertRedirect(t, uploadMedia(tc, "photo.png", testPNG(t, 40, 30)), "/admin/media")
+	img := lastMedia(t, a)
+	assertRedirect(t, uploadMedia(tc, "report <1>.pdf", []byte("%PDF-1.4\n%EOF")), "/admin/media")
+	pdf := lastMedia(t, a)
+
+	createPage(t, a, Page{Slug: "gallery", Content: "<b>See</b> " + img.Shortcode() + " and " + pdf.Shortcode() + " [media:999]"})
+
+	w := tc.get("/pages/gallery")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "&lt;b&gt;See&lt;/b&gt;")
+	assertContains(t, w, `<img src="`+img.URL()+`" alt="photo.png" width="40" height="30" loading="lazy">`)
+	assertContains(t, w, `<a href="`+pdf.URL()+`" download="report &lt;1&gt;.pdf">report &lt;1&gt;.pdf</a>`)
+	// Missing media is left as is
+	assertContains(t, w, "[media:999]")
+
+	if img.Shortcode() != "[media:"+strconv.FormatUint(uint64(img.ID), 10)+"]" {
+		t.Fatalf("unexpected shortcode %q", img.Shortcode())
+	}
+}
+
+func TestLocalMediaStorage(t *testing.T) {
+	storage, err := newLocalMediaStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", ".", "..", "../escape", "a/b", `a\b`, "/etc/passwd"} {
+		if err := storage.Save(key, strings.NewReader("x")); err == nil {
+			t.Errorf("expected key %q to be refused", key)
+		}
+		if _, _, err := storage.Open(key); err == nil {
+			t.Errorf("expected key %q to be refused by Open", key)
+		}
+		if err := storage.Delete(key); err == nil {
+			t.Errorf("expected key %q to be refused by Delete", key)
+		}
+	}
+
+	if err := storage.Save("file.txt", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	// Stored files are never overwritten
+	if err := storage.Save("file.txt", strings.NewReader("other")); err == nil {
+		t.Fatal("expected saving existing key to fail")
+	}
+
+	f, _, err := storage.Open("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "content" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	if err := storage.Delete("file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := storage.Open("file.txt"); err == nil {
+		t.Fatal("expected deleted file to be gone")
+	}
+	// Deleting missing file is not an error
+	if err := storage.Delete("file.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewMediaKey(t *testing.T) {
+	for filename, ext := range map[string]string{"photo.JPG": ".jpg", "archive.tar.gz": ".gz", "noext": "", "evil.p$p": "", "x.../..": ""} {
+		key, err := newMediaKey(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != 32+len(ext) || !strings.HasSuffix(key, ext) {
+			t.Errorf("%s: unexpected key %q", filename, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// Users who made authenticated request within this window are counted as active
+const metricsActiveUserWindow = 15 * time.Minute
+
+// appMetrics are Prometheus metrics of one app, registered in its own registry
+type appMetrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	logins       *prometheus.CounterVec
+	logouts      prometheus.Counter
+
+	// Time of last authenticated request of each user, used by app_active_sessions
+	activeUsersMu sync.Mutex
+	activeUsers   map[uint]time.Time
+	now           func() time.Time
+}
+
+func newAppMetrics(db *gorm.DB, now func() time.Time) (*appMetrics, error) {
+	m := &appMetrics{
+		registry: prometheus.NewRegistry(),
+		now:      now,
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route template and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "app_logins_total",
+			Help: "Number of sign in attempts by result.",
+		}, []string{"result"}),
+
+		logouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "app_logouts_total",
+			Help: "Number of sign outs.",
+		}),
+
+		activeUsers: map[uint]time.Time{},
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(sqlDB, "appdb"),
+		m.httpRequests,
+		m.httpDuration,
+		m.logins,
+		m.logouts,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "app_active_sessions",
+			Help: "Number of users who made authenticated request in the last 15 minutes.",
+		}, m.countActiveUsers),
+	)
+
+	return m, nil
+}
+
+// markUserActive records authenticated request of user
+func (m *appMetrics) markUserActive(id uint) {
+	m.activeUsersMu.Lock()
+	m.activeUsers[id] = m.now()
+	m.activeUsersMu.Unlock()
+}
+
+// countActiveUsers returns number of users seen within metricsActiveUserWindow and forgets others.
+// Sessions are stored in cookies, so this is the closest to number of sessions the server knows.
+func (m *appMetrics) countActiveUsers() float64 {
+	m.activeUsersMu.Lock()
+	defer m.activeUsersMu.Unlock()
+
+	since := m.now().Add(-metricsActiveUserWindow)
+	for id, seen := range m.activeUsers {
+		if seen.Before(since) {
+			delete(m.activeUsers, id)
+		}
+	}
+	return float64(len(m.activeUsers))
+}
+
+// middlewareMetrics counts requests and their duration by route template, e.g. /admin/users/:id
+func (a *App) middlewareMetrics(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	a.metrics.httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	a.metrics.httpDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+}
+
+// metricsHandlers returns handlers of /metrics, protected by basic auth if METRICS_USER and METRICS_PASSWORD are set
+func (a *App) metricsHandlers() []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+
+	if a.Config.MetricsUser != "" && a.Config.MetricsPassword != "" {
+		handlers = append(handlers, gin.BasicAuthForRealm(gin.Accounts{a.Config.MetricsUser: a.Config.MetricsPassword}, "metrics"))
+	}
+
+	return append(handlers, gin.WrapH(promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{})))
+}
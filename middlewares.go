@@ -2,12 +2,17 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func middlewareAuthRequired(c *gin.Context) {
+// Same as max age of session cookie
+const sessionDefaultLifetime = 30 * 24 * time.Hour
+
+func (a *App) middlewareAuthRequired(c *gin.Context) {
 	session := sessions.Default(c)
 	userId := session.Get("currentUser")
 
@@ -16,9 +21,9 @@ func middlewareAuthRequired(c *gin.Context) {
 		c.Abort()
 		return
 	} else {
-		var user User
-		if err := db.Where("id = ?", userId).First(&user).Error; err != nil {
+		if _, err := a.findSessionUser(c, userId); err != nil || a.sessionExpired(session) {
 			session.Delete("currentUser")
+			session.Delete("loggedInAt")
 			session.Save()
 			c.Redirect(http.StatusSeeOther, "/login")
 			c.Abort()
@@ -29,20 +34,53 @@ func middlewareAuthRequired(c *gin.Context) {
 	c.Next()
 }
 
-func middlewareSetUser(c *gin.Context) {
+func (a *App) middlewareSetUser(c *gin.Context) {
 	session := sessions.Default(c)
 	userId := session.Get("currentUser")
 
-	if userId == nil {
+	if userId == nil || a.sessionExpired(session) {
 		c.Next()
 		return
 	}
 
-	var user User
-	if err := db.Where("id = ?", userId).First(&user).Error; err != nil {
+	user, err := a.findSessionUser(c, userId)
+	if err != nil {
 		return
 	}
 	c.Set("currentUser", user)
+	a.metrics.markUserActive(user.ID)
 
 	c.Next()
 }
+
+// startSession signs user in, the sign in expires after SessionLifetime by clock of app
+func (a *App) startSession(c *gin.Context, user User) {
+	session := sessions.Default(c)
+	session.Set("currentUser", user.ID)
+	session.Set("loggedInAt", a.now().Unix())
+	if user.Locale != "" {
+		session.Set("locale", user.Locale)
+	}
+	session.Save()
+
+	a.metrics.markUserActive(user.ID)
+	c.Set("currentUser", user)
+}
+
+// sessionExpired reports whether sign in stored in session is older than SessionLifetime
+func (a *App) sessionExpired(session sessions.Session) bool {
+	loggedInAt, ok := session.Get("loggedInAt").(int64)
+	if !ok {
+		return true
+	}
+	return a.now().Sub(time.Unix(loggedInAt, 0)) > a.Config.SessionLifetime
+}
+
+// findSessionUser loads user whose ID is stored in session
+func (a *App) findSessionUser(c *gin.Context, userId interface{}) (User, error) {
+	id, ok := userId.(uint)
+	if !ok {
+		return User{}, gorm.ErrRecordNotFound
+	}
+	return a.Users.Find(c.Request.Context(), id)
+}
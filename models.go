@@ -1,13 +1,23 @@
 package main
 
-import "time"
+import (
+	"strings"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Login is unique among users not in trash, see activeUniqueIndexes
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Login     string    `gorm:"unique;size:80" json:"login"`
-	Password  string    `gorm:"size:255" json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Login    string `gorm:"size:80" json:"login"`
+	Password string `gorm:"size:255" json:"password"`
+	// Locale chosen in language switcher, empty if the user never chose one
+	Locale    string         `gorm:"size:16" json:"locale"`
+	Version   uint           `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
 func (User) TableName() string {
@@ -15,13 +25,157 @@ func (User) TableName() string {
 }
 
 type Page struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Slug         string    `gorm:"size:255" json:"slug"`
+	Content      string    `json:"content"`
+	Title        string    `gorm:"size:255" json:"title"`
+	Description  string    `gorm:"size:500" json:"description"`
+	OGImageID    *uint     `json:"og_image_id"`
+	OGImage      *Media    `gorm:"constraint:OnDelete:SET NULL" json:"og_image,omitempty"`
+	CanonicalURL string    `gorm:"size:2048" json:"canonical_url"`
+	NoIndex      bool      `json:"no_index"`
+	CategoryID   *uint     `json:"category_id"`
+	Category     *Category `gorm:"constraint:OnDelete:SET NULL" json:"category,omitempty"`
+	Tags         []Tag     `gorm:"many2many:page_tags" json:"tags,omitempty"`
+	// Fields of page are written in DEFAULT_LOCALE, translations hold them in other locales
+	Translations []PageTranslation `gorm:"constraint:OnDelete:CASCADE" json:"translations,omitempty"`
+	Version      uint              `gorm:"not null;default:1" json:"version"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt    `gorm:"index" json:"deleted_at"`
+}
+
+func (Page) TableName() string {
+	return "page"
+}
+
+// DisplayTitle returns title of page falling back to slug for pages without title
+func (p Page) DisplayTitle() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return p.Slug
+}
+
+// HasCategory reports whether page belongs to category with id
+func (p Page) HasCategory(id uint) bool {
+	return p.CategoryID != nil && *p.CategoryID == id
+}
+
+// TagNames returns comma separated names of page tags, as edited in page form
+func (p Page) TagNames() string {
+	names := make([]string, 0, len(p.Tags))
+	for _, tag := range p.Tags {
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// HasOGImage reports whether media with id is selected as OG image of page
+func (p Page) HasOGImage(id uint) bool {
+	return p.OGImageID != nil && *p.OGImageID == id
+}
+
+// Translation returns translation of page into locale, preloaded with Translations
+func (p Page) Translation(locale string) (PageTranslation, bool) {
+	for _, t := range p.Translations {
+		if t.Locale == locale {
+			return t, true
+		}
+	}
+	return PageTranslation{}, false
+}
+
+// Localized returns page with title, description and content of translation into locale.
+// Fields missing in translation are left in source locale. Returns false if there's no translation.
+func (p Page) Localized(locale string) (Page, bool) {
+	t, ok := p.Translation(locale)
+	if !ok {
+		return p, false
+	}
+
+	if t.Title != "" {
+		p.Title = t.Title
+	}
+	if t.Description != "" {
+		p.Description = t.Description
+	}
+	if t.Content != "" {
+		p.Content = t.Content
+	}
+	return p, true
+}
+
+// PageTranslation is title, description and content of page in another locale. Source fields keep the page fields
+// the translation was made from, so that translations of changed pages are shown as stale.
+type PageTranslation struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	PageID            uint      `gorm:"not null;uniqueIndex:idx_page_translation_locale" json:"page_id"`
+	Locale            string    `gorm:"size:16;not null;uniqueIndex:idx_page_translation_locale" json:"locale"`
+	Title             string    `gorm:"size:255" json:"title"`
+	Description       string    `gorm:"size:500" json:"description"`
+	Content           string    `json:"content"`
+	SourceTitle       string    `gorm:"size:255" json:"-"`
+	SourceDescription string    `gorm:"size:500" json:"-"`
+	SourceContent     string    `json:"-"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func (PageTranslation) TableName() string {
+	return "page_translation"
+}
+
+// Stale reports whether source fields of page changed since translation was made
+func (t PageTranslation) Stale(page Page) bool {
+	return t.SourceTitle != page.Title || t.SourceDescription != page.Description || t.SourceContent != page.Content
+}
+
+type Media struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Slug      string    `gorm:"unique" json:"slug"`
-	Content   string    `json:"content"`
+	Key       string    `gorm:"unique;size:255" json:"key"`
+	Filename  string    `gorm:"size:255" json:"filename"`
+	MimeType  string    `gorm:"size:255" json:"mime_type"`
+	Size      int64     `json:"size"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func (Page) TableName() string {
-	return "page"
+func (Media) TableName() string {
+	return "media"
+}
+
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"unique;size:50" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Tag) TableName() string {
+	return "tag"
+}
+
+// Category is a node of category tree. Path is a slash separated list of slugs from root, e.g. "news/local".
+type Category struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"size:100" json:"name"`
+	Slug string `gorm:"size:100" json:"slug"`
+	// 768 characters is the longest unique key MySQL allows for utf8mb4
+	Path      string    `gorm:"unique;size:768" json:"path"`
+	ParentID  *uint     `json:"parent_id"`
+	Parent    *Category `json:"parent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Category) TableName() string {
+	return "category"
+}
+
+// Depth returns level of category in tree, 0 for root categories
+func (c Category) Depth() int {
+	return strings.Count(c.Path, "/")
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin/render"
+)
+
+// reloadingRender renders templates of dev mode. It watches templates directory and rebuilds templates whose files
+// changed, so that edits show up without restart. Templates that fail to parse show the error in browser.
+type reloadingRender struct {
+	dir    string
+	fsys   fs.FS
+	fm     template.FuncMap
+	logger *slog.Logger
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+
+	mu        sync.RWMutex
+	sets      map[string][]string
+	templates map[string]*template.Template
+	errors    map[string]error
+}
+
+func newReloadingRender(dir string, fm template.FuncMap, logger *slog.Logger) (*reloadingRender, error) {
+	r := &reloadingRender{
+		dir:       dir,
+		fsys:      os.DirFS(dir),
+		fm:        fm,
+		logger:    logger,
+		done:      make(chan struct{}),
+		sets:      map[string][]string{},
+		templates: map[string]*template.Template{},
+		errors:    map[string]error{},
+	}
+
+	var err error
+	if r.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return nil, err
+	}
+	if err := r.watchDirs(); err != nil {
+		r.watcher.Close()
+		return nil, err
+	}
+
+	r.reload("")
+	go r.run()
+	return r, nil
+}
+
+// watchDirs adds templates directory and its subdirectories to watcher, fsnotify doesn't watch recursively
+func (r *reloadingRender) watchDirs() error {
+	return filepath.WalkDir(r.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return r.watcher.Add(name)
+	})
+}
+
+func (r *reloadingRender) run() {
+	defer close(r.done)
+
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					r.watchDirs()
+				}
+			}
+
+			changed, err := filepath.Rel(r.dir, event.Name)
+			if err != nil {
+				continue
+			}
+			r.reload(filepath.ToSlash(changed))
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			r.logger.Error("Failed to watch templates", "error", err)
+		}
+	}
+}
+
+// reload finds template files again and rebuilds templates which include changed file or whose files are different.
+// Empty changed rebuilds all templates.
+func (r *reloadingRender) reload(changed string) {
+	sets, err := templateSets(r.fsys)
+	if err != nil {
+		r.logger.Error("Failed to find templates", "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name := range r.sets {
+		if _, ok := sets[name]; !ok {
+			delete(r.templates, name)
+			delete(r.errors, name)
+		}
+	}
+
+	for name, files := range sets {
+		if old, ok := r.sets[name]; ok && changed != "" && slices.Equal(old, files) && !slices.Contains(files, changed) {
+			continue
+		}
+
+		tmpl, err := template.New(path.Base(files[0])).Funcs(r.fm).ParseFS(r.fsys, files...)
+		if err != nil {
+			r.logger.Error("Failed to parse template", "template", name, "error", err)
+			delete(r.templates, name)
+			r.errors[name] = err
+			continue
+		}
+		r.templates[name] = tmpl
+		delete(r.errors, name)
+	}
+	r.sets = sets
+}
+
+func (r *reloadingRender) Instance(name string, data any) render.Render {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if tmpl, ok := r.templates[name]; ok {
+		return render.HTML{Template: tmpl, Data: data}
+	}
+	if err, ok := r.errors[name]; ok {
+		return templateErrorRender{name: name, err: err}
+	}
+	return templateErrorRender{name: name, err: fmt.Errorf("template %s not found", name)}
+}
+
+// Close stops watching templates
+func (r *reloadingRender) Close() error {
+	err := r.watcher.Close()
+	<-r.done
+	return err
+}
+
+// templateErrorRender shows template error instead of the page
+type templateErrorRender struct {
+	name string
+	err  error
+}
+
+var templateErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>Template error</title></head>
+<body>
+<h1>Template error</h1>
+<p>Template <code>{{.Name}}</code> can't be rendered. Fix it and reload the page.</p>
+<pre>{{.Error}}</pre>
+</body>
+</html>
+`))
+
+func (r templateErrorRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	w.WriteHeader(http.StatusInternalServerError)
+	return templateErrorPage.Execute(w, struct {
+		Name  string
+		Error string
+	}{r.name, r.err.Error()})
+}
+
+func (r templateErrorRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+}
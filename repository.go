@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserRepository stores users. Find methods return gorm.ErrRecordNotFound for missing users.
+type UserRepository interface {
+	List(ctx context.Context) ([]User, error)
+	Count(ctx context.Context) (int64, error)
+	Find(ctx context.Context, id uint) (User, error)
+	// FindByLogin returns user not in trash with login
+	FindByLogin(ctx context.Context, login string) (User, error)
+	// FindByCredentials returns user with login and password
+	FindByCredentials(ctx context.Context, login, password string) (User, error)
+	Create(ctx context.Context, user *User) error
+	// UpdateIfVersion saves user only if its version is still version. Returns false if it was changed by someone else.
+	UpdateIfVersion(ctx context.Context, user *User, version uint) (bool, error)
+	// SetLocale saves locale chosen by user, without touching version and modification time
+	SetLocale(ctx context.Context, id uint, locale string) error
+	// Delete moves user to trash
+	Delete(ctx context.Context, user *User) error
+
+	ListTrashed(ctx context.Context) ([]User, error)
+	FindTrashed(ctx context.Context, id uint) (User, error)
+	// LoginTaken reports whether login is used by user not in trash
+	LoginTaken(ctx context.Context, login string) (bool, error)
+	Restore(ctx context.Context, user *User) error
+	// Purge permanently deletes trashed user
+	Purge(ctx context.Context, user *User) error
+	// PurgeDeletedBefore permanently deletes users trashed before t
+	PurgeDeletedBefore(ctx context.Context, t time.Time) error
+}
+
+// PageFilter narrows list of pages. Empty fields don't filter.
+type PageFilter struct {
+	// Name of tag
+	Tag string
+	// Path of category, pages of subcategories are included
+	CategoryPath string
+}
+
+// PageRepository stores pages with their tags. Find methods return gorm.ErrRecordNotFound for missing pages.
+type PageRepository interface {
+	// List returns pages with categories, tags and translations
+	List(ctx context.Context, filter PageFilter) ([]Page, error)
+	// Find returns page with category and tags
+	Find(ctx context.Context, id uint) (Page, error)
+	// FindWithTranslations returns page with category, tags and translations
+	FindWithTranslations(ctx context.Context, id uint) (Page, error)
+	// FindBySlug returns page with OG image, category, tags and translations
+	FindBySlug(ctx context.Context, slug string) (Page, error)
+	// CountIndexed returns number of pages listed in sitemaps: not marked as noindex and without canonical URL
+	// pointing elsewhere
+	CountIndexed(ctx context.Context) (int64, error)
+	// ListIndexed returns pages counted by CountIndexed, ordered by ID, with slugs, modification times and
+	// locales of translations
+	ListIndexed(ctx context.Context, offset, limit int) ([]Page, error)
+	// Create saves new page with tags, creating missing tags
+	Create(ctx context.Context, page *Page, tags []Tag) error
+	// UpdateIfVersion saves page and its tags only if its version is still version. Returns false if it was changed by someone else.
+	UpdateIfVersion(ctx context.Context, page *Page, version uint, tags []Tag) (bool, error)
+	// Delete moves page to trash
+	Delete(ctx context.Context, page *Page) error
+	// SaveTranslation creates or replaces translation of page
+	SaveTranslation(ctx context.Context, translation *PageTranslation) error
+	DeleteTranslation(ctx context.Context, translation *PageTranslation) error
+
+	ListTrashed(ctx context.Context) ([]Page, error)
+	FindTrashed(ctx context.Context, id uint) (Page, error)
+	// SlugTaken reports whether slug is used by page not in trash
+	SlugTaken(ctx context.Context, slug string) (bool, error)
+	Restore(ctx context.Context, page *Page) error
+	// Purge permanently deletes trashed page
+	Purge(ctx context.Context, page *Page) error
+	// PurgeDeletedBefore permanently deletes pages trashed before t
+	PurgeDeletedBefore(ctx context.Context, t time.Time) error
+}
+
+// paramID parses ID from URL parameter. Invalid IDs are returned as 0, which never matches a record.
+func paramID(c *gin.Context, name string) uint {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+// updateIfVersion saves all columns of record only if its version in database is still version.
+// Returns false if record was changed (or deleted) by someone else.
+func updateIfVersion(db *gorm.DB, value interface{}, version uint) (bool, error) {
+	result := db.Model(value).Select("*").Omit(clause.Associations, "CreatedAt", "DeletedAt").
+		Where("version = ?", version).
+		Updates(value)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func newGormUserRepository(db *gorm.DB) *gormUserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) List(ctx context.Context) ([]User, error) {
+	var users []User
+	err := r.db.WithContext(ctx).Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&User{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) Find(ctx context.Context, id uint) (User, error) {
+	var user User
+	err := r.db.WithContext(ctx).First(&user, id).Error
+	return user, err
+}
+
+func (r *gormUserRepository) FindByLogin(ctx context.Context, login string) (User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Where("login = ?", login).First(&user).Error
+	return user, err
+}
+
+func (r *gormUserRepository) FindByCredentials(ctx context.Context, login, password string) (User, error) {
+	var user User
+	// TODO: Encrypt password
+	err := r.db.WithContext(ctx).Where("login = ? and password = ?", login, password).First(&user).Error
+	return user, err
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUserRepository) UpdateIfVersion(ctx context.Context, user *User, version uint) (bool, error) {
+	return updateIfVersion(r.db.WithContext(ctx), user, version)
+}
+
+func (r *gormUserRepository) SetLocale(ctx context.Context, id uint, locale string) error {
+	return r.db.WithContext(ctx).Model(&User{}).Where("id = ?", id).UpdateColumn("locale", locale).Error
+}
+
+func (r *gormUserRepository) Delete(ctx context.Context, user *User) error {
+	return r.db.WithContext(ctx).Delete(user).Error
+}
+
+func (r *gormUserRepository) ListTrashed(ctx context.Context) ([]User, error) {
+	var users []User
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) FindTrashed(ctx context.Context, id uint) (User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").First(&user, id).Error
+	return user, err
+}
+
+func (r *gormUserRepository) LoginTaken(ctx context.Context, login string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&User{}).Where("login = ?", login).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormUserRepository) Restore(ctx context.Context, user *User) error {
+	return r.db.WithContext(ctx).Unscoped().Model(user).Update("deleted_at", nil).Error
+}
+
+func (r *gormUserRepository) Purge(ctx context.Context, user *User) error {
+	return r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Delete(&User{}, user.ID).Error
+}
+
+func (r *gormUserRepository) PurgeDeletedBefore(ctx context.Context, t time.Time) error {
+	return r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", t).Delete(&User{}).Error
+}
+
+type gormPageRepository struct {
+	db *gorm.DB
+}
+
+func newGormPageRepository(db *gorm.DB) *gormPageRepository {
+	return &gormPageRepository{db: db}
+}
+
+func (r *gormPageRepository) List(ctx context.Context, filter PageFilter) ([]Page, error) {
+	query := r.db.WithContext(ctx).Preload("Category").Preload("Tags").Preload("Translations", orderTranslations).Order("page.id")
+	if filter.Tag != "" {
+		query = query.Joins("JOIN page_tags ON page_tags.page_id = page.id").Joins("JOIN tag ON tag.id = page_tags.tag_id").Where("tag.name = ?", filter.Tag)
+	}
+	if filter.CategoryPath != "" {
+		query = query.Joins("JOIN category ON category.id = page.category_id").Where("category.path = ? OR category.path LIKE ?", filter.CategoryPath, filter.CategoryPath+"/%")
+	}
+
+	var pages []Page
+	err := query.Find(&pages).Error
+	return pages, err
+}
+
+func (r *gormPageRepository) Find(ctx context.Context, id uint) (Page, error) {
+	var page Page
+	err := r.db.WithContext(ctx).Preload("Category").Preload("Tags").First(&page, id).Error
+	return page, err
+}
+
+func (r *gormPageRepository) FindWithTranslations(ctx context.Context, id uint) (Page, error) {
+	var page Page
+	err := r.db.WithContext(ctx).Preload("Category").Preload("Tags").Preload("Translations", orderTranslations).First(&page, id).Error
+	return page, err
+}
+
+func (r *gormPageRepository) FindBySlug(ctx context.Context, slug string) (Page, error) {
+	var page Page
+	err := r.db.WithContext(ctx).Preload("OGImage").Preload("Category").Preload("Tags").Preload("Translations", orderTranslations).Where("slug = ?", slug).First(&page).Error
+	return page, err
+}
+
+func (r *gormPageRepository) CountIndexed(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.indexed(ctx).Model(&Page{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormPageRepository) ListIndexed(ctx context.Context, offset, limit int) ([]Page, error) {
+	var pages []Page
+	err := r.indexed(ctx).Select("id", "slug", "updated_at").
+		Preload("Translations", func(db *gorm.DB) *gorm.DB {
+			return orderTranslations(db.Select("id", "page_id", "locale", "updated_at"))
+		}).
+		Order("id").Offset(offset).Limit(limit).Find(&pages).Error
+	return pages, err
+}
+
+// indexed selects pages listed in sitemaps
+func (r *gormPageRepository) indexed(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("no_index = ? AND canonical_url = ?", false, "")
+}
+
+// orderTranslations orders preloaded translations of page by locale
+func orderTranslations(db *gorm.DB) *gorm.DB {
+	return db.Order("locale")
+}
+
+// saveTags creates missing tags and replaces tags of saved page
+func saveTags(tx *gorm.DB, page *Page, tags []Tag) error {
+	for i := range tags {
+		if err := tx.Where(Tag{Name: tags[i].Name}).FirstOrCreate(&tags[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(page).Association("Tags").Replace(tags)
+}
+
+func (r *gormPageRepository) Create(ctx context.Context, page *Page, tags []Tag) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Create(page).Error; err != nil {
+			return err
+		}
+		return saveTags(tx, page, tags)
+	})
+}
+
+func (r *gormPageRepository) UpdateIfVersion(ctx context.Context, page *Page, version uint, tags []Tag) (bool, error) {
+	var updated bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if updated, err = updateIfVersion(tx, page, version); err != nil || !updated {
+			return err
+		}
+		return saveTags(tx, page, tags)
+	})
+	return updated && err == nil, err
+}
+
+func (r *gormPageRepository) Delete(ctx context.Context, page *Page) error {
+	return r.db.WithContext(ctx).Delete(page).Error
+}
+
+func (r *gormPageRepository) SaveTranslation(ctx context.Context, translation *PageTranslation) error {
+	return r.db.WithContext(ctx).Save(translation).Error
+}
+
+func (r *gormPageRepository) DeleteTranslation(ctx context.Context, translation *PageTranslation) error {
+	return r.db.WithContext(ctx).Delete(translation).Error
+}
+
+func (r *gormPageRepository) ListTrashed(ctx context.Context) ([]Page, error) {
+	var pages []Page
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&pages).Error
+	return pages, err
+}
+
+func (r *gormPageRepository) FindTrashed(ctx context.Context, id uint) (Page, error) {
+	var page Page
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").First(&page, id).Error
+	return page, err
+}
+
+func (r *gormPageRepository) SlugTaken(ctx context.Context, slug string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Page{}).Where("slug = ?", slug).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormPageRepository) Restore(ctx context.Context, page *Page) error {
+	return r.db.WithContext(ctx).Unscoped().Model(page).Update("deleted_at", nil).Error
+}
+
+func (r *gormPageRepository) Purge(ctx context.Context, page *Page) error {
+	return r.purge(r.db.WithContext(ctx).Where("id = ?", page.ID))
+}
+
+func (r *gormPageRepository) PurgeDeletedBefore(ctx context.Context, t time.Time) error {
+	return r.purge(r.db.WithContext(ctx).Where("deleted_at < ?", t))
+}
+
+// purge permanently deletes trashed pages matching query together with their tag links and translations
+func (r *gormPageRepository) purge(query *gorm.DB) error {
+	var ids []uint
+	if err := query.Unscoped().Model(&Page{}).Where("deleted_at IS NOT NULL").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return query.Session(&gorm.Session{NewDB: true}).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("delete from page_tags where page_id in ?", ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id IN ?", ids).Delete(&PageTranslation{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Page{}, ids).Error
+	})
+}
@@ -2,35 +2,85 @@ package main
 
 import "github.com/gin-gonic/gin"
 
-func setupRoutes(router *gin.Engine) {
-	router.GET("/", actionPublicRoot)
-
-	router.GET("/pages/:slug", actionPublicPage)
-
-	router.GET("/login", middlewareSetUser, actionPublicLoginForm)
-	router.POST("/login", middlewareSetUser, actionPublicLoginSubmit)
-	router.GET("/logout", middlewareSetUser, actionPublicLogout)
-
-	router.GET("/admin", actionAdminIndex)
-	router.GET("/admin/users/new", middlewareAuthRequired, middlewareSetUser, actionAdminUsersNew)
-	router.POST("/admin/users/create", middlewareAuthRequired, middlewareSetUser, actionAdminUsersCreate)
-	router.GET("/admin/users", middlewareAuthRequired, middlewareSetUser, actionAdminUsersIndex)
-	router.GET("/admin/users/:id", middlewareAuthRequired, middlewareSetUser, actionAdminUsersShow)
-	router.GET("/admin/users/:id/edit", middlewareAuthRequired, middlewareSetUser, actionAdminUsersEdit)
-	router.POST("/admin/users/:id/update", middlewareAuthRequired, middlewareSetUser, actionAdminUsersUpdate)
-	router.POST("/admin/users/:id/delete", middlewareAuthRequired, middlewareSetUser, actionAdminUsersDestroy)
-	router.GET("/admin/pages", middlewareAuthRequired, middlewareSetUser, actionAdminPagesIndex)
-	router.GET("/admin/pages/new", middlewareAuthRequired, middlewareSetUser, actionAdminPagesNew)
-	router.POST("/admin/pages/create", middlewareAuthRequired, middlewareSetUser, actionAdminPagesCreate)
-	router.GET("/admin/pages/:id", middlewareAuthRequired, middlewareSetUser, actionAdminPagesShow)
-	router.GET("/admin/pages/:id/edit", middlewareAuthRequired, middlewareSetUser, actionAdminPagesEdit)
-	router.POST("/admin/pages/:id/update", middlewareAuthRequired, middlewareSetUser, actionAdminPagesUpdate)
-	router.POST("/admin/pages/:id/delete", middlewareAuthRequired, middlewareSetUser, actionAdminPagesDestroy)
-
-	if isTest() {
-		router.GET("/tools", actionPublicTools)
-		router.GET("/tools/db-clear", actionPublicToolsDBClear)
-		router.GET("/tools/seed", actionPublicToolsSeed)
-		router.GET("/tools/sql", actionPublicToolsSQL)
+func (a *App) setupRoutes(router *gin.Engine) {
+	router.GET("/", a.actionPublicRoot)
+
+	router.GET("/metrics", a.metricsHandlers()...)
+	router.GET("/healthz", actionHealthz)
+	router.GET("/readyz", a.actionReadyz)
+
+	router.GET("/pages/:slug", a.actionPublicPage)
+
+	router.GET("/tags/:tag", a.actionPublicTag)
+	router.GET("/categories/*path", a.actionPublicCategory)
+
+	router.GET("/media/:key", a.actionPublicMedia)
+	router.GET("/static/*filepath", a.actionStatic)
+
+	router.GET("/sitemap.xml", a.actionPublicSitemap)
+	router.GET("/sitemaps/:file", a.actionPublicSitemapChunk)
+	router.GET("/robots.txt", a.actionPublicRobots)
+
+	router.GET("/login", a.middlewareSetUser, a.actionPublicLoginForm)
+	router.POST("/login", a.middlewareSetUser, a.actionPublicLoginSubmit)
+	router.GET("/logout", a.middlewareSetUser, a.actionPublicLogout)
+	router.POST("/locale", a.middlewareSetUser, a.actionLocale)
+
+	router.GET("/admin", a.actionAdminIndex)
+	router.GET("/admin/users/new", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersNew)
+	router.POST("/admin/users/create", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersCreate)
+	router.GET("/admin/users", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersIndex)
+	router.GET("/admin/users/:id", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersShow)
+	router.GET("/admin/users/:id/edit", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersEdit)
+	router.POST("/admin/users/:id/update", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersUpdate)
+	router.POST("/admin/users/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminUsersDestroy)
+	router.GET("/admin/pages", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesIndex)
+	router.GET("/admin/pages/new", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesNew)
+	router.POST("/admin/pages/create", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesCreate)
+	router.GET("/admin/pages/:id", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesShow)
+	router.GET("/admin/pages/:id/edit", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesEdit)
+	router.POST("/admin/pages/:id/update", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesUpdate)
+	router.POST("/admin/pages/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPagesDestroy)
+	router.GET("/admin/pages/:id/translations", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPageTranslationsIndex)
+	router.GET("/admin/pages/:id/translations/:locale", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPageTranslationsEdit)
+	router.POST("/admin/pages/:id/translations/:locale", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPageTranslationsUpdate)
+	router.POST("/admin/pages/:id/translations/:locale/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminPageTranslationsDestroy)
+	router.GET("/admin/trash", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminTrashIndex)
+	router.POST("/admin/trash/users/:id/restore", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminTrashUsersRestore)
+	router.POST("/admin/trash/users/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminTrashUsersDestroy)
+	router.POST("/admin/trash/pages/:id/restore", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminTrashPagesRestore)
+	router.POST("/admin/trash/pages/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminTrashPagesDestroy)
+	router.GET("/admin/categories", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminCategoriesIndex)
+	router.POST("/admin/categories/create", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminCategoriesCreate)
+	router.POST("/admin/categories/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminCategoriesDestroy)
+	router.GET("/admin/media", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminMediaIndex)
+	router.POST("/admin/media/create", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminMediaCreate)
+	router.POST("/admin/media/:id/delete", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminMediaDestroy)
+	router.GET("/admin/audit", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminAuditIndex)
+	router.GET("/admin/audit/export", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminAuditExport)
+	router.GET("/status", a.middlewareAuthRequired, a.middlewareSetUser, a.actionAdminStatus)
+
+	if a.Config.Test {
+		router.GET("/tools", a.middlewareSetUser, a.actionPublicTools)
+		router.GET("/tools/db-clear", a.middlewareSetUser, a.actionPublicToolsDBClear)
+		router.GET("/tools/seed", a.middlewareSetUser, a.actionPublicToolsSeed)
+		router.GET("/tools/sql", a.middlewareSetUser, a.actionPublicToolsSQL)
+		router.POST("/tools/sql", a.middlewareSetUser, a.actionPublicToolsSQL)
+		router.GET("/tools/sql/history", a.middlewareSetUser, a.actionPublicToolsSQLHistory)
+		router.POST("/tools/sql/saved", a.middlewareSetUser, a.actionPublicToolsSQLSave)
+		router.POST("/tools/sql/saved/:id/delete", a.middlewareSetUser, a.actionPublicToolsSQLSavedDestroy)
+		router.POST("/tools/generate", a.middlewareSetUser, a.actionPublicToolsGenerate)
+		router.POST("/tools/login-as", a.middlewareSetUser, a.actionPublicToolsLoginAs)
+		router.GET("/tools/clock", a.middlewareSetUser, a.actionPublicToolsClock)
+		router.POST("/tools/clock/freeze", a.middlewareSetUser, a.actionPublicToolsClockFreeze)
+		router.POST("/tools/clock/advance", a.middlewareSetUser, a.actionPublicToolsClockAdvance)
+		router.POST("/tools/clock/reset", a.middlewareSetUser, a.actionPublicToolsClockReset)
+		router.GET("/tools/mail", a.middlewareSetUser, a.actionPublicToolsMail)
+		router.POST("/tools/mail/clear", a.middlewareSetUser, a.actionPublicToolsMailClear)
+		router.GET("/tools/fixtures", a.middlewareSetUser, a.actionPublicToolsFixturesIndex)
+		router.POST("/tools/fixtures/:name", a.middlewareSetUser, a.actionPublicToolsFixturesLoad)
+		router.POST("/tools/snapshots/:name", a.middlewareSetUser, a.actionPublicToolsSnapshotsCreate)
+		router.POST("/tools/snapshots/:name/restore", a.middlewareSetUser, a.actionPublicToolsSnapshotsRestore)
+		router.POST("/tools/snapshots/:name/delete", a.middlewareSetUser, a.actionPublicToolsSnapshotsDestroy)
 	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default server settings, each can be overridden by environment variable with the same name
+const (
+	defaultHTTPAddr              = ":8080"
+	defaultHTTPReadHeaderTimeout = 10 * time.Second
+	// Uploads of large media files are read within this time
+	defaultHTTPReadTimeout  = 2 * time.Minute
+	defaultHTTPWriteTimeout = 2 * time.Minute
+	defaultHTTPIdleTimeout  = 2 * time.Minute
+	// In-flight requests are given this time to finish after SIGINT/SIGTERM
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+func (a *App) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              a.Config.HTTPAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: a.Config.HTTPReadHeaderTimeout,
+		ReadTimeout:       a.Config.HTTPReadTimeout,
+		WriteTimeout:      a.Config.HTTPWriteTimeout,
+		IdleTimeout:       a.Config.HTTPIdleTimeout,
+		ErrorLog:          slog.NewLogLogger(a.HTTPLogger.Handler(), slog.LevelWarn),
+	}
+}
+
+// listen serves HTTPS if TLS_CERT_FILE and TLS_KEY_FILE are set or TLS_SELF_SIGNED is on, HTTP otherwise
+func (a *App) listen(srv *http.Server) error {
+	certFile, keyFile := a.Config.TLSCertFile, a.Config.TLSKeyFile
+
+	switch {
+	case certFile != "" && keyFile != "":
+		a.Logger.Info("Listening with TLS", "addr", srv.Addr, "cert", certFile)
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	case a.Config.TLSSelfSigned:
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		a.Logger.Warn("Listening with self-signed certificate, use for development only", "addr", srv.Addr)
+		return srv.ListenAndServeTLS("", "")
+	default:
+		a.Logger.Info("Listening", "addr", srv.Addr)
+		return srv.ListenAndServe()
+	}
+}
+
+// runServer serves app until ctx is done, then waits for in-flight requests to finish
+func (a *App) runServer(ctx context.Context) error {
+	srv := a.newHTTPServer(a.Router())
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- a.listen(srv)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	a.shuttingDown.Store(true)
+	timeout := a.Config.ShutdownTimeout
+	a.Logger.Info("Shutting down, waiting for in-flight requests", "timeout", timeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// selfSignedCertificate generates certificate for localhost valid for a year
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum number of URLs allowed in a single sitemap file by the sitemaps.org protocol
+const sitemapMaxURLs = 50000
+
+const sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+const sitemapXHTMLNS = "http://www.w3.org/1999/xhtml"
+
+type sitemapURL struct {
+	Loc        string             `xml:"loc"`
+	LastMod    string             `xml:"lastmod,omitempty"`
+	Alternates []sitemapAlternate `xml:"xhtml:link"`
+}
+
+// sitemapAlternate is URL of page in another locale, see https://developers.google.com/search/docs/specialty/international/localized-versions#sitemap
+type sitemapAlternate struct {
+	Rel      string `xml:"rel,attr"`
+	HrefLang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapURLSet struct {
+	XMLName    xml.Name     `xml:"urlset"`
+	XMLNS      string       `xml:"xmlns,attr"`
+	XMLNSXHTML string       `xml:"xmlns:xhtml,attr"`
+	URLs       []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// seoCache keeps pages listed in sitemaps and robots.txt file until pages change. Entries don't depend on
+// request: URLs are joined with base URL when responding, and chunks past the last one are never cached.
+type seoCache struct {
+	mu sync.Mutex
+	// Incremented on invalidation, so that values built from old data are not stored
+	generation uint64
+	entries    map[string]interface{}
+}
+
+func newSEOCache() *seoCache {
+	return &seoCache{entries: map[string]interface{}{}}
+}
+
+// invalidateSEOCache drops cached sitemaps and robots.txt. Call it whenever pages are changed.
+func (a *App) invalidateSEOCache() {
+	a.seo.mu.Lock()
+	defer a.seo.mu.Unlock()
+	a.seo.entries = map[string]interface{}{}
+	a.seo.generation++
+}
+
+// cachedSEO returns cached value for key or builds and stores it. Value is built without holding the lock,
+// so one slow query doesn't hold up other SEO requests.
+func cachedSEO[T any](a *App, key string, build func() (T, error)) (T, error) {
+	a.seo.mu.Lock()
+	if v, ok := a.seo.entries[key]; ok {
+		a.seo.mu.Unlock()
+		return v.(T), nil
+	}
+	generation := a.seo.generation
+	a.seo.mu.Unlock()
+
+	v, err := build()
+	if err != nil {
+		return v, err
+	}
+
+	a.seo.mu.Lock()
+	defer a.seo.mu.Unlock()
+	if a.seo.generation == generation {
+		a.seo.entries[key] = v
+	}
+	return v, nil
+}
+
+// baseURL returns configured BASE_URL or guesses it from the request
+func (a *App) baseURL(c *gin.Context) string {
+	if a.Config.BaseURL != "" {
+		return a.Config.BaseURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func marshalSitemap(v interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// sitemapPageCount returns number of pages listed in sitemaps. Pages marked as noindex and pages with canonical URL
+// pointing elsewhere are not listed.
+func (a *App) sitemapPageCount(ctx context.Context) (int64, error) {
+	return cachedSEO(a, "sitemap count", func() (int64, error) {
+		return a.Pages.CountIndexed(ctx)
+	})
+}
+
+// sitemapChunkPages returns slugs, modification times and translation locales of pages of the given sitemap chunk (0-based)
+func (a *App) sitemapChunkPages(ctx context.Context, chunk int) ([]Page, error) {
+	return cachedSEO(a, "sitemap "+strconv.Itoa(chunk), func() ([]Page, error) {
+		return a.Pages.ListIndexed(ctx, chunk*sitemapMaxURLs, sitemapMaxURLs)
+	})
+}
+
+// sitemapChunks returns number of sitemap files pages are split into
+func sitemapChunks(count int64) int {
+	return int((count + sitemapMaxURLs - 1) / sitemapMaxURLs)
+}
+
+// renderSitemapPages renders urlset of pages. Each page is listed by its canonical URL in DEFAULT_LOCALE with
+// links to its translations, the same as hreflang links of the page itself.
+func (a *App) renderSitemapPages(base string, pages []Page) ([]byte, error) {
+	set := sitemapURLSet{XMLNS: sitemapXMLNS, XMLNSXHTML: sitemapXHTMLNS}
+	for _, page := range pages {
+		entry := sitemapURL{Loc: localePageURL(base, a.Config.DefaultLocale, page.Slug)}
+
+		// Translations change the page in its other locales
+		lastMod := page.UpdatedAt
+		for _, t := range page.Translations {
+			if t.UpdatedAt.After(lastMod) {
+				lastMod = t.UpdatedAt
+			}
+		}
+		entry.LastMod = lastMod.UTC().Format(time.RFC3339)
+
+		// Page without translations has no alternates worth listing
+		if len(page.Translations) > 0 {
+			for _, alternate := range a.pageAlternates(base, page) {
+				entry.Alternates = append(entry.Alternates, sitemapAlternate{Rel: "alternate", HrefLang: alternate.Locale, Href: alternate.URL})
+			}
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+
+	return marshalSitemap(set)
+}
+
+// renderSitemapIndex renders sitemap index pointing to every chunk of count pages
+func renderSitemapIndex(base string, count int64) ([]byte, error) {
+	index := sitemapIndex{XMLNS: sitemapXMLNS}
+	for i := 1; i <= sitemapChunks(count); i++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: base + "/sitemaps/" + strconv.Itoa(i) + ".xml"})
+	}
+
+	return marshalSitemap(index)
+}
+
+// buildRobots returns content of configured ROBOTS_TXT_FILE or the default rules
+func (a *App) buildRobots(base string) ([]byte, error) {
+	if path := a.Config.RobotsTxtFile; path != "" {
+		return cachedSEO(a, "robots", func() ([]byte, error) { return os.ReadFile(path) })
+	}
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	b.WriteString("Disallow: /admin\n")
+	b.WriteString("Disallow: /login\n")
+	b.WriteString("Disallow: /logout\n")
+	b.WriteString("Disallow: /tools\n")
+	b.WriteString("\n")
+	b.WriteString("Sitemap: " + base + "/sitemap.xml\n")
+	return []byte(b.String()), nil
+}
+
+// actionPublicSitemap lists pages, or points to sitemap chunks when pages don't fit into one file
+func (a *App) actionPublicSitemap(c *gin.Context) {
+	count, err := a.sitemapPageCount(c.Request.Context())
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error building sitemap: "+err.Error())
+		return
+	}
+
+	var body []byte
+	if count <= sitemapMaxURLs {
+		var pages []Page
+		if pages, err = a.sitemapChunkPages(c.Request.Context(), 0); err == nil {
+			body, err = a.renderSitemapPages(a.baseURL(c), pages)
+		}
+	} else {
+		body, err = renderSitemapIndex(a.baseURL(c), count)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error building sitemap: "+err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+}
+
+func (a *App) actionPublicSitemapChunk(c *gin.Context) {
+	n, err := strconv.Atoi(strings.TrimSuffix(c.Param("file"), ".xml"))
+	if err != nil || n < 1 {
+		c.String(http.StatusNotFound, "Sitemap not found")
+		return
+	}
+
+	count, err := a.sitemapPageCount(c.Request.Context())
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error building sitemap: "+err.Error())
+		return
+	}
+	if n > sitemapChunks(count) {
+		c.String(http.StatusNotFound, "Sitemap not found")
+		return
+	}
+
+	pages, err := a.sitemapChunkPages(c.Request.Context(), n-1)
+	var body []byte
+	if err == nil {
+		body, err = a.renderSitemapPages(a.baseURL(c), pages)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error building sitemap: "+err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+}
+
+func (a *App) actionPublicRobots(c *gin.Context) {
+	body, err := a.buildRobots(a.baseURL(c))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error building robots.txt: "+err.Error())
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", body)
+}
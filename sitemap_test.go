@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	createPage(t, a, Page{Slug: "about"})
+	createPage(t, a, Page{Slug: "hidden", NoIndex: true})
+
+	w := tc.get("/sitemap.xml")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<loc>http://example.com/en/pages/about</loc>")
+	if strings.Contains(w.Body.String(), "hidden") {
+		t.Fatal("expected noindex page not to be listed")
+	}
+	// Page canonical elsewhere is listed there, not here
+	createPage(t, a, Page{Slug: "copy", CanonicalURL: "http://example.com/en/pages/about"})
+	a.invalidateSEOCache()
+	if strings.Contains(tc.get("/sitemap.xml").Body.String(), "copy") {
+		t.Fatal("expected page with canonical URL of other page not to be listed")
+	}
+	assertContains(t, tc.get("/sitemaps/1.xml"), "<loc>http://example.com/en/pages/about</loc>")
+
+	// Cached pages are dropped when pages change
+	assertRedirect(t, tc.post("/admin/pages/create", url.Values{"slug": {"contacts"}, "content": {"x"}}), "/admin/pages")
+	assertContains(t, tc.get("/sitemap.xml"), "<loc>http://example.com/en/pages/contacts</loc>")
+}
+
+// Cache doesn't grow with requests: base URL taken from request and chunks past the last one are not cached
+func TestSitemapCacheIsBounded(t *testing.T) {
+	a := newTestApp(t)
+	tc := newTestClient(t, a)
+	createPage(t, a, Page{Slug: "about"})
+
+	for _, host := range []string{"a.example", "b.example", "c.example"} {
+		req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+		req.Host = host
+		w := tc.do(req)
+		assertStatus(t, w, http.StatusOK)
+		assertContains(t, w, "<loc>http://"+host+"/en/pages/about</loc>")
+
+		req = httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+		req.Host = host
+		assertContains(t, tc.do(req), "Sitemap: http://"+host+"/sitemap.xml")
+	}
+	for _, path := range []string{"/sitemaps/2.xml", "/sitemaps/1000.xml", "/sitemaps/0.xml", "/sitemaps/x.xml"} {
+		assertStatus(t, tc.get(path), http.StatusNotFound)
+	}
+
+	a.seo.mu.Lock()
+	entries := len(a.seo.entries)
+	a.seo.mu.Unlock()
+	// Page count and the only chunk
+	if entries != 2 {
+		t.Fatalf("expected 2 cache entries, got %d", entries)
+	}
+}
+
+func TestSitemapBaseURL(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BaseURL = "https://www.example.org"
+	a, err := newApp(cfg, openTestDB(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPage(t, a, Page{Slug: "about"})
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	req.Host = "evil.example"
+	assertContains(t, newTestClient(t, a).do(req), "<loc>https://www.example.org/en/pages/about</loc>")
+	assertContains(t, newTestClient(t, a).get("/robots.txt"), "Sitemap: https://www.example.org/sitemap.xml")
+}
+
+// fakePageRepository serves pages listed in sitemaps from memory, other methods are not implemented
+type fakePageRepository struct {
+	PageRepository
+	pages []Page
+}
+
+func (r *fakePageRepository) CountIndexed(ctx context.Context) (int64, error) {
+	return int64(len(r.pages)), nil
+}
+
+func (r *fakePageRepository) ListIndexed(ctx context.Context, offset, limit int) ([]Page, error) {
+	return r.pages[min(offset, len(r.pages)):min(offset+limit, len(r.pages))], nil
+}
+
+// Pages that don't fit into one sitemap are split into chunks listed by sitemap index
+func TestSitemapChunks(t *testing.T) {
+	a := newTestApp(t)
+	pages := &fakePageRepository{}
+	for i := range sitemapMaxURLs + 1 {
+		pages.pages = append(pages.pages, Page{Slug: "page-" + strconv.Itoa(i+1), UpdatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)})
+	}
+	a.Pages = pages
+	tc := newTestClient(t, a)
+
+	w := tc.get("/sitemap.xml")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<sitemapindex")
+	assertContains(t, w, "<loc>http://example.com/sitemaps/2.xml</loc>")
+	if strings.Contains(w.Body.String(), "/sitemaps/3.xml") {
+		t.Fatal("expected two chunks")
+	}
+
+	w = tc.get("/sitemaps/2.xml")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<loc>http://example.com/en/pages/page-"+strconv.Itoa(sitemapMaxURLs+1)+"</loc>")
+	assertContains(t, w, "<lastmod>2020-01-02T03:04:05Z</lastmod>")
+	if strings.Count(w.Body.String(), "<url>") != 1 {
+		t.Fatalf("expected one page in the last chunk, got %s", w.Body.String())
+	}
+	assertStatus(t, tc.get("/sitemaps/3.xml"), http.StatusNotFound)
+}
+
+var canonicalLinkRe = regexp.MustCompile(`<link rel="canonical" href="([^"]+)">`)
+
+// Sitemap lists pages by their canonical URL, translations are linked as alternates like on the page itself
+func TestSitemapTranslations(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	page := createPage(t, a, Page{Slug: "about", Title: "About us", Content: "We make things"})
+	createPage(t, a, Page{Slug: "contacts", Content: "Write us"})
+	translatePage(t, tc, page, "ru", url.Values{"content": {"Мы делаем вещи"}})
+
+	w := tc.get("/sitemap.xml")
+	assertStatus(t, w, http.StatusOK)
+	var set struct {
+		URLs []struct {
+			Loc   string `xml:"loc"`
+			Links []struct {
+				Rel      string `xml:"rel,attr"`
+				HrefLang string `xml:"hreflang,attr"`
+				Href     string `xml:"href,attr"`
+			} `xml:"http://www.w3.org/1999/xhtml link"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.URLs) != 2 {
+		t.Fatalf("expected 2 pages, got %s", w.Body.String())
+	}
+
+	for _, entry := range set.URLs {
+		match := canonicalLinkRe.FindStringSubmatch(newTestClient(t, a).get(strings.TrimPrefix(entry.Loc, "http://example.com")).Body.String())
+		if match == nil || match[1] != entry.Loc {
+			t.Errorf("expected canonical link of %s to be the same URL, got %v", entry.Loc, match)
+		}
+	}
+
+	about := set.URLs[0]
+	var links []string
+	for _, link := range about.Links {
+		links = append(links, link.Rel+" "+link.HrefLang+" "+link.Href)
+	}
+	want := []string{
+		"alternate en http://example.com/en/pages/about",
+		"alternate ru http://example.com/ru/pages/about",
+		"alternate x-default http://example.com/pages/about",
+	}
+	if strings.Join(links, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected alternates %q, got %q", want, links)
+	}
+	if match := canonicalLinkRe.FindStringSubmatch(newTestClient(t, a).get("/ru/pages/about").Body.String()); match == nil || match[1] != about.Links[1].Href {
+		t.Fatalf("expected canonical link of translation to match its alternate, got %v", match)
+	}
+	if len(set.URLs[1].Links) != 0 {
+		t.Fatalf("expected no alternates of untranslated page, got %+v", set.URLs[1].Links)
+	}
+	// Saving and deleting translations updates cached sitemap
+	contacts, err := a.Pages.FindBySlug(context.Background(), "contacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	translatePage(t, tc, contacts, "ru", url.Values{"content": {"Пишите нам"}})
+	assertContains(t, tc.get("/sitemap.xml"), `href="http://example.com/ru/pages/contacts"`)
+	assertRedirect(t, tc.post(pagePath(page, "/translations/ru/delete"), nil), pagePath(page, "/translations"))
+	if strings.Contains(tc.get("/sitemap.xml").Body.String(), "http://example.com/ru/pages/about") {
+		t.Fatal("expected deleted translation to be gone from sitemap")
+	}
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of SQL_CONSOLE_TIMEOUT and SQL_CONSOLE_MAX_ROWS
+const (
+	sqlConsoleDefaultTimeout = 5 * time.Second
+	sqlConsoleDefaultMaxRows = 1000
+)
+
+// Number of queries shown in history of SQL console
+const sqlConsoleHistorySize = 50
+
+// Binary values longer than this are cut in HTML results
+const sqlConsoleMaxBytesShown = 64
+
+// SQLQuery is a query executed in SQL console, kept as history of its user
+type SQLQuery struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     *uint     `gorm:"index" json:"user_id"`
+	Query      string    `json:"query"`
+	Write      bool      `json:"write"`
+	RowCount   int       `json:"row_count"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (SQLQuery) TableName() string {
+	return "sql_query"
+}
+
+// SavedSQLQuery is a named query of SQL console, visible to the user who saved it
+type SavedSQLQuery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (SavedSQLQuery) TableName() string {
+	return "saved_sql_query"
+}
+
+type sqlColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable,omitempty"`
+}
+
+// sqlResult is result of SQL console query. Rows are capped at SQL_CONSOLE_MAX_ROWS.
+type sqlResult struct {
+	Columns   []sqlColumn
+	Rows      [][]interface{}
+	Truncated bool
+	Duration  time.Duration
+}
+
+// Maps returns rows as column name to value maps
+func (r *sqlResult) Maps() []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		m := make(map[string]interface{}, len(row))
+		for i, column := range r.Columns {
+			m[column.Name] = row[i]
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// sqlCell is a value of result formatted for HTML table
+type sqlCell struct {
+	Null bool
+	// "bytes", "json" or empty for other values
+	Kind string
+	Text string
+}
+
+// Cells returns rows formatted for HTML table
+func (r *sqlResult) Cells() [][]sqlCell {
+	out := make([][]sqlCell, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		cells := make([]sqlCell, len(row))
+		for i, v := range row {
+			cells[i] = newSQLCell(v, r.Columns[i].Type)
+		}
+		out = append(out, cells)
+	}
+	return out
+}
+
+// newSQLCell formats value: binary data as hex, JSON documents indented
+func newSQLCell(v interface{}, columnType string) sqlCell {
+	switch v := v.(type) {
+	case nil:
+		return sqlCell{Null: true, Text: "NULL"}
+	case []byte:
+		text := "0x" + hex.EncodeToString(v)
+		if len(v) > sqlConsoleMaxBytesShown {
+			text = "0x" + hex.EncodeToString(v[:sqlConsoleMaxBytesShown]) + "…"
+		}
+		return sqlCell{Kind: "bytes", Text: text + " (" + strconv.Itoa(len(v)) + " bytes)"}
+	case string:
+		if isJSONColumnType(columnType) || strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[") {
+			var indented bytes.Buffer
+			if json.Indent(&indented, []byte(v), "", "  ") == nil {
+				return sqlCell{Kind: "json", Text: indented.String()}
+			}
+		}
+	}
+	return sqlCell{Text: sqlValueString(v)}
+}
+
+func isJSONColumnType(columnType string) bool {
+	return columnType == "JSON" || columnType == "JSONB"
+}
+
+// isBinaryColumnType reports whether column holds raw bytes rather than text
+func isBinaryColumnType(columnType string) bool {
+	switch columnType {
+	case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		return true
+	}
+	return false
+}
+
+// sqlValue converts scanned value to JSON friendly one. MySQL returns text as bytes, which would be encoded as base64,
+// so bytes are kept only for binary columns and data that isn't valid UTF-8.
+func sqlValue(v interface{}, columnType string) interface{} {
+	if b, ok := v.([]byte); ok && !isBinaryColumnType(columnType) && utf8.Valid(b) {
+		return string(b)
+	}
+	return v
+}
+
+// sqlValueString formats value for CSV, NULL is an empty string
+func sqlValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// explainQuery returns query showing execution plan of q. Postgres and MySQL run q to measure it,
+// SQLite only shows the plan.
+func explainQuery(dialect, q string) string {
+	if dialect == "sqlite" {
+		return "EXPLAIN QUERY PLAN " + q
+	}
+	return "EXPLAIN ANALYZE " + q
+}
+
+// errSQLMultipleStatements is returned for read-only queries of several statements. One of them could leave
+// read-only mode, e.g. "PRAGMA query_only = OFF; COMMIT" on SQLite, before the next one writes.
+var errSQLMultipleStatements = errors.New("read-only mode runs one statement at a time, post with write=1 to run several")
+
+// sqlDollarQuoteRe matches opening of Postgres dollar-quoted string, e.g. $$ or $body$
+var sqlDollarQuoteRe = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// sqlStatementCount returns number of non-empty statements of q. Semicolons in strings, quoted identifiers and
+// comments are skipped. When in doubt it counts more statements rather than fewer.
+func sqlStatementCount(dialect, q string) int {
+	count := 0
+	// Set when current statement has something besides spaces and comments
+	pending := false
+	for i := 0; i < len(q); i++ {
+		ch := q[i]
+		switch {
+		case ch == ';':
+			if pending {
+				count++
+				pending = false
+			}
+			continue
+		case isSQLLineComment(dialect, q[i:]):
+			if end := strings.IndexByte(q[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(q)
+			}
+			continue
+		case strings.HasPrefix(q[i:], "/*"):
+			if end := strings.Index(q[i+2:], "*/"); end >= 0 {
+				i += 2 + end + 1
+			} else {
+				i = len(q)
+			}
+			continue
+		case ch == '\'' || ch == '"' || ch == '`':
+			// MySQL escapes quotes with backslash in all strings, Postgres only in E'...' strings
+			backslash := dialect == "mysql" ||
+				(dialect == "postgres" && ch == '\'' && i > 0 && (q[i-1] == 'E' || q[i-1] == 'e') && (i == 1 || !isSQLIdentByte(q[i-2])))
+			i = skipSQLQuoted(q, i, backslash)
+		case ch == '$' && dialect == "postgres":
+			if m := sqlDollarQuoteRe.FindString(q[i:]); m != "" {
+				if end := strings.Index(q[i+len(m):], m); end >= 0 {
+					i += len(m) + end + len(m) - 1
+				} else {
+					i = len(q)
+				}
+			}
+		}
+		if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+			pending = true
+		}
+	}
+	if pending {
+		count++
+	}
+	return count
+}
+
+// isSQLLineComment reports whether q starts with comment running to end of line. MySQL needs space after "--".
+func isSQLLineComment(dialect, q string) bool {
+	if dialect != "mysql" {
+		return strings.HasPrefix(q, "--")
+	}
+	return q[0] == '#' || strings.HasPrefix(q, "-- ") || strings.HasPrefix(q, "--\t") || strings.HasPrefix(q, "--\n") || q == "--"
+}
+
+// skipSQLQuoted returns index of quote closing string or identifier opened at i. Doubled quote is an escaped quote.
+func skipSQLQuoted(q string, i int, backslash bool) int {
+	quote := q[i]
+	for i++; i < len(q); i++ {
+		switch {
+		case backslash && q[i] == '\\':
+			i++
+		case q[i] == quote:
+			if i+1 < len(q) && q[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(q)
+}
+
+// isSQLIdentByte reports whether b can be part of unquoted SQL identifier
+func isSQLIdentByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// runSQL executes q with timeout and row cap. Unless write is set, it runs in read-only transaction which is rolled back
+// and must be a single statement.
+func (a *App) runSQL(ctx context.Context, q string, write bool) (*sqlResult, error) {
+	if !write && sqlStatementCount(a.DB.Dialector.Name(), q) > 1 {
+		return nil, errSQLMultipleStatements
+	}
+
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.Config.SQLConsoleTimeout)
+	defer cancel()
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dialect := a.DB.Dialector.Name()
+
+	// SQLite ignores read-only transaction option, query_only is set on the connection instead
+	if !write && dialect == "sqlite" {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return nil, err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: !write})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Let server stop the query too, other databases are stopped by cancelling ctx
+	if dialect == "postgres" {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = "+strconv.FormatInt(a.Config.SQLConsoleTimeout.Milliseconds(), 10)); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, sqlConsoleError(ctx, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &sqlResult{}
+	for _, columnType := range columnTypes {
+		column := sqlColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+		if nullable, ok := columnType.Nullable(); ok {
+			column.Nullable = &nullable
+		}
+		result.Columns = append(result.Columns, column)
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == a.Config.SQLConsoleMaxRows {
+			result.Truncated = true
+			break
+		}
+
+		values := make([]interface{}, len(columnTypes))
+		pointers := make([]interface{}, len(columnTypes))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i := range values {
+			values[i] = sqlValue(values[i], result.Columns[i].Type)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlConsoleError(ctx, err)
+	}
+	rows.Close()
+
+	result.Duration = time.Since(start)
+
+	if write {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// sqlConsoleError replaces error of cancelled query with a readable one
+func sqlConsoleError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.New("query timed out")
+	}
+	return err
+}
+
+// saveSQLHistory adds query to history of current user
+func (a *App) saveSQLHistory(c *gin.Context, entry SQLQuery) {
+	if user, exists := c.Get("currentUser"); exists {
+		id := user.(User).ID
+		entry.UserID = &id
+	}
+
+	if err := a.requestDB(c).Create(&entry).Error; err != nil {
+		a.Logger.ErrorContext(c, "Failed to save SQL history", "request_id", c.GetString("requestID"), "error", err)
+	}
+}
+
+// sqlHistory returns last queries of current user, or of anonymous users when nobody is logged in
+func (a *App) sqlHistory(c *gin.Context) ([]SQLQuery, error) {
+	query := a.requestDB(c).Order("id desc").Limit(sqlConsoleHistorySize)
+	if user, exists := c.Get("currentUser"); exists {
+		query = query.Where("user_id = ?", user.(User).ID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	var history []SQLQuery
+	err := query.Find(&history).Error
+	return history, err
+}
+
+// savedSQLQueries returns queries saved by current user, or by anonymous users when nobody is logged in
+func (a *App) savedSQLQueries(c *gin.Context) ([]SavedSQLQuery, error) {
+	query := a.requestDB(c).Order("name")
+	if user, exists := c.Get("currentUser"); exists {
+		query = query.Where("user_id = ?", user.(User).ID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	var saved []SavedSQLQuery
+	err := query.Find(&saved).Error
+	return saved, err
+}
+
+// renderTools renders tools page with SQL console history and saved queries of current user
+func (a *App) renderTools(c *gin.Context, code int, h gin.H) {
+	var errs []string
+	if e, ok := h["errors"].([]string); ok {
+		errs = e
+	}
+
+	history, err := a.sqlHistory(c)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	saved, err := a.savedSQLQueries(c)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	h["history"] = history
+	h["saved"] = saved
+	if len(errs) > 0 {
+		h["errors"] = errs
+	}
+	renderHTML(c, code, "public/tools.html", addFlashesAndUser(c, &h))
+}
+
+// formOrQuery returns posted form value, falling back to query string
+func formOrQuery(c *gin.Context, name string) string {
+	if v := c.PostForm(name); v != "" {
+		return v
+	}
+	return c.Query(name)
+}
+
+// actionPublicToolsSQL runs query from "q" parameter. Queries are read-only unless posted with write=1,
+// explain=1 shows execution plan instead. Result is shown on tools page, or returned as JSON to API clients.
+// format=csv or format=json downloads result as a file.
+func (a *App) actionPublicToolsSQL(c *gin.Context) {
+	q := formOrQuery(c, "q")
+	write := formOrQuery(c, "write") != ""
+	explain := formOrQuery(c, "explain") != ""
+	form := gin.H{"q": q, "write": write, "explain": explain}
+
+	fail := func(code int, message string) {
+		if wantsJSON(c) {
+			c.JSON(code, gin.H{"error": message})
+			return
+		}
+		form["errors"] = []string{message}
+		a.renderTools(c, code, form)
+	}
+
+	if q == "" {
+		fail(http.StatusBadRequest, "Missing 'q' parameter")
+		return
+	}
+
+	if write && c.Request.Method != http.MethodPost {
+		fail(http.StatusBadRequest, "Write mode requires POST")
+		return
+	}
+
+	executed := q
+	if explain {
+		executed = explainQuery(a.DB.Dialector.Name(), q)
+	}
+
+	action := "tools.sql"
+	if write {
+		action = "tools.sql_write"
+	}
+	a.auditDetails(c, action, "", 0, nil, nil, q)
+
+	result, err := a.runSQL(c.Request.Context(), executed, write)
+
+	entry := SQLQuery{Query: executed, Write: write}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.RowCount = len(result.Rows)
+		entry.DurationMS = result.Duration.Milliseconds()
+	}
+	a.saveSQLHistory(c, entry)
+
+	if write {
+		// Query can change pages
+		a.invalidateSEOCache()
+	}
+
+	if errors.Is(err, errSQLMultipleStatements) {
+		fail(http.StatusBadRequest, "Error executing SQL query: "+err.Error())
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, "Error executing SQL query: "+err.Error())
+		return
+	}
+
+	switch formOrQuery(c, "format") {
+	case "csv":
+		c.Header("Content-Disposition", `attachment; filename="query.csv"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+
+		w := csv.NewWriter(c.Writer)
+		header := make([]string, len(result.Columns))
+		for i, column := range result.Columns {
+			header[i] = csvSafeCell(column.Name)
+		}
+		w.Write(header)
+		for _, row := range result.Rows {
+			record := make([]string, len(row))
+			for i, v := range row {
+				record[i] = csvSafeCell(sqlValueString(v))
+			}
+			w.Write(record)
+		}
+		w.Flush()
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="query.json"`)
+		c.JSON(http.StatusOK, result.Maps())
+	default:
+		if !wantsJSON(c) {
+			form["result"] = result
+			a.renderTools(c, http.StatusOK, form)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"q":           q,
+			"write":       write,
+			"columns":     result.Columns,
+			"out":         result.Maps(),
+			"truncated":   result.Truncated,
+			"duration_ms": result.Duration.Milliseconds(),
+		})
+	}
+}
+
+// actionPublicToolsSQLHistory returns last queries of current user
+func (a *App) actionPublicToolsSQLHistory(c *gin.Context) {
+	history, err := a.sqlHistory(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// actionPublicToolsSQLSave saves query from the console under a name
+func (a *App) actionPublicToolsSQLSave(c *gin.Context) {
+	session := sessions.Default(c)
+
+	saved := SavedSQLQuery{Name: strings.TrimSpace(c.PostForm("name")), Query: c.PostForm("q")}
+	if saved.Name == "" || saved.Query == "" {
+		session.AddFlash("Query and its name are required.")
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/tools")
+		return
+	}
+
+	if user, exists := c.Get("currentUser"); exists {
+		id := user.(User).ID
+		saved.UserID = &id
+	}
+
+	if err := a.requestDB(c).Create(&saved).Error; err != nil {
+		session.AddFlash(err.Error())
+	} else {
+		session.AddFlash("Query was saved.")
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/tools")
+}
+
+// actionPublicToolsSQLSavedDestroy deletes saved query of current user
+func (a *App) actionPublicToolsSQLSavedDestroy(c *gin.Context) {
+	session := sessions.Default(c)
+
+	query := a.requestDB(c).Where("id = ?", paramID(c, "id"))
+	if user, exists := c.Get("currentUser"); exists {
+		query = query.Where("user_id = ?", user.(User).ID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	result := query.Delete(&SavedSQLQuery{})
+	switch {
+	case result.Error != nil:
+		session.AddFlash(result.Error.Error())
+	case result.RowsAffected == 0:
+		session.AddFlash("Saved query not found")
+	default:
+		session.AddFlash("Saved query was deleted.")
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/tools")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaStorage stores uploaded media files by key.
+// Local filesystem is the only implementation for now; S3-compatible storage can be added by implementing this interface.
+type MediaStorage interface {
+	// Save writes content under key
+	Save(key string, r io.Reader) error
+	// Open returns content stored under key and its modification time
+	Open(key string) (io.ReadSeekCloser, time.Time, error)
+	// Delete removes content stored under key
+	Delete(key string) error
+}
+
+// Directory of uploaded media unless MEDIA_DIR is set
+const mediaDefaultDir = "./uploads"
+
+// localMediaStorage keeps files in a directory on local filesystem
+type localMediaStorage struct {
+	dir string
+}
+
+func newLocalMediaStorage(dir string) (*localMediaStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &localMediaStorage{dir: dir}, nil
+}
+
+// path converts key into file path, refusing keys that escape storage dir
+func (s *localMediaStorage) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", errors.New("invalid media key")
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *localMediaStorage) Save(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *localMediaStorage) Open(key string) (io.ReadSeekCloser, time.Time, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+
+	return f, info.ModTime(), nil
+}
+
+func (s *localMediaStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
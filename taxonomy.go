@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Tags are lowercase words of letters, digits, "-" and "_"
+var tagNameRe = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{1,50}$`)
+
+// Category slugs are used in URLs, so only latin letters, digits and "-" are allowed
+var categorySlugRe = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// parseTagNames splits comma separated tags, normalizes them and drops duplicates
+func parseTagNames(s string) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.Join(strings.Fields(strings.ToLower(name)), "-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// tagsFromForm reads tags of page form. Tags are not saved, missing ones are created when page is saved.
+func tagsFromForm(c *gin.Context) ([]Tag, []string) {
+	var tags []Tag
+	var validationErrors []string
+
+	for _, name := range parseTagNames(c.PostForm("tags")) {
+		if !tagNameRe.MatchString(name) {
+			validationErrors = append(validationErrors, validationError(c, "Tags", "Invalid tag \"%s\"", name))
+			continue
+		}
+		tags = append(tags, Tag{Name: name})
+	}
+
+	return tags, validationErrors
+}
+
+// categoryIDFromForm reads category of page form
+func (a *App) categoryIDFromForm(c *gin.Context) (*uint, []string) {
+	db := a.requestDB(c)
+
+	value := c.PostForm("category_id")
+	if value == "" {
+		return nil, nil
+	}
+
+	var category Category
+	if err := db.First(&category, value).Error; err != nil {
+		return nil, []string{validationError(c, "CategoryID", "Invalid input")}
+	}
+	return &category.ID, nil
+}
+
+// allCategories returns categories ordered so that children follow their parent
+func (a *App) allCategories(c *gin.Context) []Category {
+	var categories []Category
+	a.requestDB(c).Order("path").Find(&categories)
+	return categories
+}
+
+// allTagNames returns names of all tags for autocomplete
+func (a *App) allTagNames(c *gin.Context) []string {
+	var names []string
+	a.requestDB(c).Model(&Tag{}).Order("name").Pluck("name", &names)
+	return names
+}
+
+func (a *App) actionAdminCategoriesIndex(c *gin.Context) {
+	renderHTML(c, http.StatusOK, "admin/categories/index.html", addFlashesAndUser(c, &gin.H{"categories": a.allCategories(c), "category": Category{}}))
+}
+
+func (a *App) actionAdminCategoriesCreate(c *gin.Context) {
+	db := a.requestDB(c)
+
+	var category Category
+	category.Name = c.PostForm("name")
+	category.Slug = c.PostForm("slug")
+
+	category_input := &CategoryInput{
+		Name: category.Name,
+		Slug: category.Slug,
+	}
+
+	// Validate user input
+	var validationErrors []string
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(category_input); err != nil {
+		validationErrors = humanValidationErrors(c, err)
+	} else if !categorySlugRe.MatchString(category.Slug) {
+		validationErrors = append(validationErrors, validationError(c, "Slug", "Only lowercase latin letters, digits and \"-\" are allowed"))
+	}
+
+	category.Path = category.Slug
+	if parentID := c.PostForm("parent_id"); parentID != "" {
+		var parent Category
+		if err := db.First(&parent, parentID).Error; err != nil {
+			validationErrors = append(validationErrors, validationError(c, "ParentID", "Invalid input"))
+		} else {
+			category.ParentID = &parent.ID
+			category.Path = parent.Path + "/" + category.Slug
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		renderHTML(c, http.StatusBadRequest, "admin/categories/index.html", addFlashesAndUser(c, &gin.H{"errors": validationErrors, "categories": a.allCategories(c), "category": category}))
+		return
+	}
+
+	if err := db.Create(&category).Error; err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/categories/index.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}, "categories": a.allCategories(c), "category": category}))
+		return
+	}
+
+	a.audit(c, "create", "category", category.ID, nil, category)
+
+	session := sessions.Default(c)
+	session.AddFlash(tr(c, "Category was added."))
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/categories")
+}
+
+func (a *App) actionAdminCategoriesDestroy(c *gin.Context) {
+	db := a.requestDB(c)
+
+	id := c.Param("id")
+	session := sessions.Default(c)
+
+	var children int64
+	db.Model(&Category{}).Where("parent_id = ?", id).Count(&children)
+	if children > 0 {
+		session.AddFlash(tr(c, "Category has subcategories. Delete them first."))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/categories")
+		return
+	}
+
+	var category Category
+	if err := db.First(&category, id).Error; err != nil {
+		session.AddFlash(tr(c, "Category not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/categories")
+		return
+	}
+
+	if err := db.Delete(&category).Error; err != nil {
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/categories")
+		return
+	}
+
+	a.audit(c, "delete", "category", category.ID, category, nil)
+
+	session.AddFlash(tr(c, "Category was deleted."))
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/categories")
+}
+
+func (a *App) actionPublicTag(c *gin.Context) {
+	db := a.requestDB(c)
+
+	var tag Tag
+	if err := db.Where("name = ?", c.Param("tag")).First(&tag).Error; err != nil {
+		renderHTML(c, http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Tag not found")}}))
+		return
+	}
+
+	pages, err := a.Pages.List(c.Request.Context(), PageFilter{Tag: tag.Name})
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+
+	renderHTML(c, http.StatusOK, "public/tag.html", &gin.H{"tag": tag, "pages": a.localizePages(c, pages)})
+}
+
+// actionPublicCategory lists pages of category and all its subcategories
+func (a *App) actionPublicCategory(c *gin.Context) {
+	db := a.requestDB(c)
+
+	path := strings.Trim(c.Param("path"), "/")
+
+	var category Category
+	if err := db.Where("path = ?", path).First(&category).Error; err != nil {
+		renderHTML(c, http.StatusNotFound, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Category not found")}}))
+		return
+	}
+
+	var subcategories []Category
+	db.Where("parent_id = ?", category.ID).Order("name").Find(&subcategories)
+
+	pages, err := a.Pages.List(c.Request.Context(), PageFilter{CategoryPath: category.Path})
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "public/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+
+	renderHTML(c, http.StatusOK, "public/category.html", &gin.H{"category": category, "subcategories": subcategories, "pages": a.localizePages(c, pages)})
+}
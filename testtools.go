@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actionPublicToolsLoginAs signs in as user with "login" or "id" without password and redirects like sign in form
+// (or to "redirect"). API clients get the user as JSON.
+func (a *App) actionPublicToolsLoginAs(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var user User
+	var err error
+	if login := formOrQuery(c, "login"); login != "" {
+		user, err = a.Users.FindByLogin(ctx, login)
+	} else {
+		var id uint64
+		id, err = strconv.ParseUint(formOrQuery(c, "id"), 10, 64)
+		if err == nil {
+			user, err = a.Users.Find(ctx, uint(id))
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	a.startSession(c, user)
+	a.audit(c, "tools.login_as", "user", user.ID, nil, nil)
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, gin.H{"user": user})
+		return
+	}
+
+	// Only local paths, so that the endpoint can't redirect elsewhere
+	redirect := formOrQuery(c, "redirect")
+	if !isLocalPath(redirect) {
+		redirect = "/admin/users"
+	}
+	c.Redirect(http.StatusSeeOther, redirect)
+}
+
+// testClockJSON describes app clock
+func testClockJSON(clock *testClock) gin.H {
+	return gin.H{"now": clock.Now(), "frozen": clock.Frozen()}
+}
+
+// toolsClock returns clock that can be changed, or responds with error when app runs on system clock
+func (a *App) toolsClock(c *gin.Context) (*testClock, bool) {
+	clock, ok := a.Clock.(*testClock)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Clock can't be changed"})
+	}
+	return clock, ok
+}
+
+// actionPublicToolsClock shows current time of app
+func (a *App) actionPublicToolsClock(c *gin.Context) {
+	if clock, ok := a.toolsClock(c); ok {
+		c.JSON(http.StatusOK, testClockJSON(clock))
+	}
+}
+
+// actionPublicToolsClockFreeze stops app clock at "time" (RFC 3339), or at current time of the clock
+func (a *App) actionPublicToolsClockFreeze(c *gin.Context) {
+	clock, ok := a.toolsClock(c)
+	if !ok {
+		return
+	}
+
+	moment := clock.Now()
+	if value := formOrQuery(c, "time"); value != "" {
+		var err error
+		if moment, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'time' parameter: " + err.Error()})
+			return
+		}
+	}
+
+	clock.Freeze(moment)
+	c.JSON(http.StatusOK, testClockJSON(clock))
+}
+
+// actionPublicToolsClockAdvance moves app clock forward by "by" (Go duration, e.g. "36h")
+func (a *App) actionPublicToolsClockAdvance(c *gin.Context) {
+	clock, ok := a.toolsClock(c)
+	if !ok {
+		return
+	}
+
+	d, err := time.ParseDuration(formOrQuery(c, "by"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'by' parameter: " + err.Error()})
+		return
+	}
+
+	clock.Advance(d)
+	c.JSON(http.StatusOK, testClockJSON(clock))
+}
+
+// actionPublicToolsClockReset returns app clock to system time
+func (a *App) actionPublicToolsClockReset(c *gin.Context) {
+	clock, ok := a.toolsClock(c)
+	if !ok {
+		return
+	}
+
+	clock.Reset()
+	c.JSON(http.StatusOK, testClockJSON(clock))
+}
+
+// actionPublicToolsMail lists emails sent by the app
+func (a *App) actionPublicToolsMail(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mail": a.outbox.Sent()})
+}
+
+// actionPublicToolsMailClear empties the outbox
+func (a *App) actionPublicToolsMailClear(c *gin.Context) {
+	a.outbox.Clear()
+	c.JSON(http.StatusOK, gin.H{"mail": []Mail{}})
+}
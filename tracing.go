@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Service name reported in traces unless OTEL_SERVICE_NAME is set
+const tracingServiceName = "go-crud-example"
+
+var tracer = otel.Tracer("github.com/sigmaray/go-crud-example")
+
+// initTracing sets up trace exporter chosen by OTEL_TRACES_EXPORTER: "otlp" (configured by standard
+// OTEL_EXPORTER_OTLP_* variables), "stdout" or "none" (default). Returned function flushes pending spans.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := sdkresource.Merge(
+		sdkresource.Default(),
+		sdkresource.NewSchemaless(semconv.ServiceName(tracingServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME overrides the default name
+	resource, err = sdkresource.Merge(resource, sdkresource.Environment())
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// middlewareTracing starts span of request named after route template
+func middlewareTracing() gin.HandlerFunc {
+	return otelgin.Middleware(tracingServiceName)
+}
+
+// middlewareTracingWriter makes request context (with span) available to renderers, which only receive response writer
+func middlewareTracingWriter(c *gin.Context) {
+	c.Writer = &tracingWriter{ResponseWriter: c.Writer, ctx: c.Request.Context()}
+	c.Next()
+}
+
+type tracingWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+// tracingHTMLRender wraps renderer of templates with span of template execution
+type tracingHTMLRender struct {
+	render.HTMLRender
+}
+
+func (r tracingHTMLRender) Instance(name string, data any) render.Render {
+	return tracingRender{inner: r.HTMLRender.Instance(name, data), name: name}
+}
+
+type tracingRender struct {
+	inner render.Render
+	name  string
+}
+
+func (r tracingRender) WriteContentType(w http.ResponseWriter) {
+	r.inner.WriteContentType(w)
+}
+
+func (r tracingRender) Render(w http.ResponseWriter) error {
+	tw, ok := w.(*tracingWriter)
+	if !ok {
+		return r.inner.Render(w)
+	}
+
+	_, span := tracer.Start(tw.ctx, "template "+r.name, trace.WithAttributes(attribute.String("template.name", r.name)))
+	defer span.End()
+
+	err := r.inner.Render(w)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+const tracingSpanKey = "otel:span"
+
+// registerTracingCallbacks adds span to each gorm query made with context of traced request
+func registerTracingCallbacks(db *gorm.DB) error {
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			// Queries outside of requests (or without request context) would start their own traces
+			if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+				return
+			}
+
+			ctx, span := tracer.Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(tracingSpanKey, span)
+		}
+	}
+
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		defer span.End()
+
+		span.SetAttributes(
+			semconv.DBSystemKey.String(tx.Dialector.Name()),
+			semconv.DBQueryText(tx.Statement.SQL.String()),
+			attribute.String("db.table", tx.Statement.Table),
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("otel:before_create", before("create")),
+		callbacks.Create().After("gorm:create").Register("otel:after_create", after),
+		callbacks.Query().Before("gorm:query").Register("otel:before_query", before("query")),
+		callbacks.Query().After("gorm:query").Register("otel:after_query", after),
+		callbacks.Update().Before("gorm:update").Register("otel:before_update", before("update")),
+		callbacks.Update().After("gorm:update").Register("otel:after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("otel:before_delete", before("delete")),
+		callbacks.Delete().After("gorm:delete").Register("otel:after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("otel:before_row", before("row")),
+		callbacks.Row().After("gorm:row").Register("otel:after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("otel:before_raw", before("raw")),
+		callbacks.Raw().After("gorm:raw").Register("otel:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tracingLogHandler adds trace_id and span_id of span in context to log records
+type tracingLogHandler struct {
+	slog.Handler
+}
+
+func (h tracingLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h tracingLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return tracingLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h tracingLogHandler) WithGroup(name string) slog.Handler {
+	return tracingLogHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// localizePage returns page in locale of request and the locale its content is in. Page fields are written in
+// DEFAULT_LOCALE, so pages without translation into the locale of request fall back to it.
+// Stale translations are still shown, they are closer to the reader's language than the source.
+func (a *App) localizePage(c *gin.Context, page Page) (Page, string) {
+	locale := requestLocale(c)
+	if locale == a.Config.DefaultLocale {
+		return page, locale
+	}
+	if localized, ok := page.Localized(locale); ok {
+		return localized, locale
+	}
+	return page, a.Config.DefaultLocale
+}
+
+// localizePages returns pages with titles in locale of request, for lists of pages
+func (a *App) localizePages(c *gin.Context, pages []Page) []Page {
+	localized := make([]Page, len(pages))
+	for i, page := range pages {
+		localized[i], _ = a.localizePage(c, page)
+	}
+	return localized
+}
+
+// pageAlternate is URL of page in one locale, shown as hreflang link
+type pageAlternate struct {
+	Locale string
+	URL    string
+}
+
+// localePageURL returns URL of page shown in locale, which is also its canonical URL in that locale
+func localePageURL(base, locale, slug string) string {
+	return base + "/" + locale + "/pages/" + slug
+}
+
+// pageAlternates returns URLs of page in source locale and in locale of every translation,
+// and "x-default" URL which shows page in locale of visitor
+func (a *App) pageAlternates(base string, page Page) []pageAlternate {
+	alternates := []pageAlternate{{a.Config.DefaultLocale, localePageURL(base, a.Config.DefaultLocale, page.Slug)}}
+	for _, t := range page.Translations {
+		if t.Locale == a.Config.DefaultLocale || !messages.Has(t.Locale) {
+			continue
+		}
+		alternates = append(alternates, pageAlternate{t.Locale, localePageURL(base, t.Locale, page.Slug)})
+	}
+	return append(alternates, pageAlternate{"x-default", base + "/pages/" + page.Slug})
+}
+
+// translationLocales returns locales pages can be translated into: every locale of UI except DEFAULT_LOCALE
+func (a *App) translationLocales() []string {
+	var locales []string
+	for _, locale := range messages.Locales() {
+		if locale != a.Config.DefaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// pageTranslationStatus tells whether page is translated into locale, and whether the translation is stale
+type pageTranslationStatus struct {
+	Locale      string           `json:"locale"`
+	Name        string           `json:"name"`
+	Translation *PageTranslation `json:"translation"`
+	Stale       bool             `json:"stale"`
+}
+
+// pageTranslationStatuses returns status of page translation into every translation locale
+func (a *App) pageTranslationStatuses(page Page) []pageTranslationStatus {
+	var statuses []pageTranslationStatus
+	for _, locale := range a.translationLocales() {
+		status := pageTranslationStatus{Locale: locale, Name: messages.Name(locale)}
+		if t, ok := page.Translation(locale); ok {
+			status.Translation = &t
+			status.Stale = t.Stale(page)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// sourceFieldChange is field of page changed since translation was made
+type sourceFieldChange struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// sourceChanges shows how page changed since translation was made, so that translator updates only changed parts
+type sourceChanges struct {
+	Fields []sourceFieldChange
+	// Diff of content, "-" lines are the source of translation and "+" lines the current content
+	Diff []diffLine
+}
+
+// translationSourceChanges compares source of stale translation with page, returns nil for translations up to date
+func translationSourceChanges(t PageTranslation, page Page) *sourceChanges {
+	if !t.Stale(page) {
+		return nil
+	}
+
+	changes := &sourceChanges{}
+	for _, field := range []sourceFieldChange{
+		{"Title", t.SourceTitle, page.Title},
+		{"Description", t.SourceDescription, page.Description},
+	} {
+		if field.Before != field.After {
+			changes.Fields = append(changes.Fields, field)
+		}
+	}
+	if t.SourceContent != page.Content {
+		changes.Diff = diffLines(t.SourceContent, page.Content)
+	}
+	return changes
+}
+
+// findPageWithTranslations returns page of "id" parameter with its translations, or responds with error
+func (a *App) findPageWithTranslations(c *gin.Context) (Page, bool) {
+	page, err := a.Pages.FindWithTranslations(c.Request.Context(), paramID(c, "id"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		message := err.Error()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			code = http.StatusNotFound
+			message = tr(c, "Page not found")
+		}
+		if wantsJSON(c) {
+			c.JSON(code, gin.H{"error": message})
+		} else {
+			renderHTML(c, code, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{message}}))
+		}
+		return page, false
+	}
+	return page, true
+}
+
+// translationLocaleParam returns "locale" parameter if pages can be translated into it, or responds with error
+func (a *App) translationLocaleParam(c *gin.Context) (string, bool) {
+	locale := c.Param("locale")
+	if messages.Has(locale) && locale != a.Config.DefaultLocale {
+		return locale, true
+	}
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": tr(c, "Unknown locale")})
+	} else {
+		renderHTML(c, http.StatusNotFound, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{tr(c, "Unknown locale")}}))
+	}
+	return "", false
+}
+
+// pageTranslationsURL returns URL of list of page translations
+func pageTranslationsURL(page Page) string {
+	return "/admin/pages/" + strconv.FormatUint(uint64(page.ID), 10) + "/translations"
+}
+
+// actionAdminPageTranslationsIndex lists locales of page translations with status of each
+func (a *App) actionAdminPageTranslationsIndex(c *gin.Context) {
+	page, ok := a.findPageWithTranslations(c)
+	if !ok {
+		return
+	}
+
+	statuses := a.pageTranslationStatuses(page)
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, gin.H{"source_locale": a.Config.DefaultLocale, "translations": statuses})
+		return
+	}
+
+	renderHTML(c, http.StatusOK, "admin/pages/translations.html", addFlashesAndUser(c, &gin.H{"page": page, "statuses": statuses, "sourceName": messages.Name(a.Config.DefaultLocale)}))
+}
+
+// translateFormData adds what side-by-side translation editor shows besides the translation itself
+func (a *App) translateFormData(page Page, locale string, translation PageTranslation, exists bool, h *gin.H) *gin.H {
+	(*h)["page"] = page
+	(*h)["locale"] = locale
+	(*h)["localeName"] = messages.Name(locale)
+	(*h)["sourceName"] = messages.Name(a.Config.DefaultLocale)
+	(*h)["translation"] = translation
+	if exists {
+		(*h)["changes"] = translationSourceChanges(translation, page)
+	}
+	return h
+}
+
+// actionAdminPageTranslationsEdit shows source of page next to its translation into "locale"
+func (a *App) actionAdminPageTranslationsEdit(c *gin.Context) {
+	locale, ok := a.translationLocaleParam(c)
+	if !ok {
+		return
+	}
+	page, ok := a.findPageWithTranslations(c)
+	if !ok {
+		return
+	}
+
+	translation, exists := page.Translation(locale)
+	renderHTML(c, http.StatusOK, "admin/pages/translate.html", addFlashesAndUser(c, a.translateFormData(page, locale, translation, exists, &gin.H{})))
+}
+
+// actionAdminPageTranslationsUpdate creates or replaces translation of page into "locale". The translation is made
+// from the current page, so saving marks it as up to date.
+func (a *App) actionAdminPageTranslationsUpdate(c *gin.Context) {
+	locale, ok := a.translationLocaleParam(c)
+	if !ok {
+		return
+	}
+	page, ok := a.findPageWithTranslations(c)
+	if !ok {
+		return
+	}
+
+	translation, exists := page.Translation(locale)
+	before := translation
+
+	translation.PageID = page.ID
+	translation.Locale = locale
+	translation.Title = c.PostForm("title")
+	translation.Description = c.PostForm("description")
+	translation.Content = c.PostForm("content")
+
+	translation_input := &PageTranslationInput{
+		Content:     translation.Content,
+		Title:       translation.Title,
+		Description: translation.Description,
+	}
+
+	// Validate user input
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(translation_input); err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": humanValidationErrors(c, err)})
+			return
+		}
+		renderHTML(c, http.StatusBadRequest, "admin/pages/translate.html", addFlashesAndUser(c, a.translateFormData(page, locale, translation, exists, &gin.H{"errors": humanValidationErrors(c, err)})))
+		return
+	}
+
+	translation.SourceTitle = page.Title
+	translation.SourceDescription = page.Description
+	translation.SourceContent = page.Content
+
+	if err := a.Pages.SaveTranslation(c.Request.Context(), &translation); err != nil {
+		if wantsJSON(c) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		renderHTML(c, http.StatusInternalServerError, "admin/pages/translate.html", addFlashesAndUser(c, a.translateFormData(page, locale, translation, exists, &gin.H{"errors": []string{err.Error()}})))
+		return
+	}
+
+	// Translations are listed in sitemaps as alternates
+	a.invalidateSEOCache()
+
+	if exists {
+		a.audit(c, "update", "page_translation", translation.ID, before, translation)
+	} else {
+		a.audit(c, "create", "page_translation", translation.ID, nil, translation)
+	}
+
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, translation)
+		return
+	}
+
+	session := sessions.Default(c)
+	session.AddFlash(tr(c, "Translation was saved."))
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, pageTranslationsURL(page))
+}
+
+// actionAdminPageTranslationsDestroy deletes translation of page into "locale", the page is then shown in source locale
+func (a *App) actionAdminPageTranslationsDestroy(c *gin.Context) {
+	locale, ok := a.translationLocaleParam(c)
+	if !ok {
+		return
+	}
+	page, ok := a.findPageWithTranslations(c)
+	if !ok {
+		return
+	}
+
+	translation, exists := page.Translation(locale)
+	if !exists {
+		session := sessions.Default(c)
+		session.AddFlash(tr(c, "Translation not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, pageTranslationsURL(page))
+		return
+	}
+
+	if err := a.Pages.DeleteTranslation(c.Request.Context(), &translation); err != nil {
+		session := sessions.Default(c)
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, pageTranslationsURL(page))
+		return
+	}
+
+	a.audit(c, "delete", "page_translation", translation.ID, translation, nil)
+
+	a.invalidateSEOCache()
+
+	session := sessions.Default(c)
+	session.AddFlash(tr(c, "Translation was deleted."))
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, pageTranslationsURL(page))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// translatePage saves translation of page into locale through the translation editor
+func translatePage(t *testing.T, tc *testClient, page Page, locale string, form url.Values) {
+	t.Helper()
+	assertRedirect(t, tc.post(pagePath(page, "/translations/"+locale), form), pagePath(page, "/translations"))
+}
+
+func TestPageTranslations(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	page := createPage(t, a, Page{Slug: "about", Title: "About us", Content: "We make things"})
+
+	translatePage(t, tc, page, "ru", url.Values{"title": {"О нас"}, "content": {"Мы делаем вещи"}})
+
+	w := tc.get("/ru/pages/about")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "<title>О нас</title>")
+	assertContains(t, w, `<div lang="ru">`)
+	assertContains(t, w, "Мы делаем вещи")
+	assertContains(t, w, `<link rel="canonical" href="http://example.com/ru/pages/about">`)
+	assertContains(t, w, `<link rel="alternate" hreflang="en" href="http://example.com/en/pages/about">`)
+	assertContains(t, w, `<link rel="alternate" hreflang="ru" href="http://example.com/ru/pages/about">`)
+	assertContains(t, w, `<link rel="alternate" hreflang="x-default" href="http://example.com/pages/about">`)
+
+	w = tc.get("/en/pages/about")
+	assertContains(t, w, "<title>About us</title>")
+	assertContains(t, w, "We make things")
+
+	// Unprefixed URL shows the page in negotiated locale
+	req := httptest.NewRequest(http.MethodGet, "/pages/about", nil)
+	req.Header.Set("Accept-Language", "ru")
+	assertContains(t, newTestClient(t, a).do(req), "Мы делаем вещи")
+
+	// Lists show translated titles
+	assertContains(t, tc.get("/ru"), "О нас")
+}
+
+func TestPageTranslationFallback(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	page := createPage(t, a, Page{Slug: "about", Title: "About us", Description: "Who we are", Content: "We make things"})
+
+	// Missing translation falls back to source locale and tells so
+	w := tc.get("/ru/pages/about")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, "Эта страница ещё не переведена на ваш язык.")
+	assertContains(t, w, `<div lang="en">`)
+	assertContains(t, w, "We make things")
+	assertContains(t, w, `<link rel="canonical" href="http://example.com/en/pages/about">`)
+	if strings.Contains(w.Body.String(), `hreflang="ru"`) {
+		t.Fatal("expected no hreflang link to missing translation")
+	}
+
+	// Fields missing in translation are shown in source locale
+	translatePage(t, tc, page, "ru", url.Values{"content": {"Мы делаем вещи"}})
+	w = tc.get("/ru/pages/about")
+	assertContains(t, w, "<title>About us</title>")
+	assertContains(t, w, `<meta name="description" content="Who we are">`)
+	assertContains(t, w, "Мы делаем вещи")
+}
+
+func TestPageTranslationEditor(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	page := createPage(t, a, Page{Slug: "about", Title: "About us", Content: "We make things"})
+	path := pagePath(page, "/translations")
+
+	assertContains(t, tc.get(path), "Missing")
+	w := tc.get(path + "/ru")
+	assertStatus(t, w, http.StatusOK)
+	assertContains(t, w, `<textarea id="source_content" rows="15" readonly style="width: 100%;">We make things</textarea>`)
+
+	assertStatus(t, tc.post(path+"/ru", url.Values{"title": {"О нас"}}), http.StatusBadRequest)
+	assertStatus(t, tc.get(path+"/en"), http.StatusNotFound)
+	assertStatus(t, tc.get(path+"/xx"), http.StatusNotFound)
+	assertStatus(t, tc.get("/admin/pages/999/translations"), http.StatusNotFound)
+
+	translatePage(t, tc, page, "ru", url.Values{"title": {"О нас"}, "content": {"Мы делаем вещи"}})
+	assertContains(t, tc.get(path), "Up to date")
+
+	// Changing the page makes translation stale, editor shows what changed
+	if err := a.DB.Model(&page).Update("content", "We make good things").Error; err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, tc.get(path), "<strong>Stale</strong>")
+	w = tc.get(path + "/ru")
+	assertContains(t, w, `data-selenium="stale"`)
+	assertContains(t, w, "<del>- We make things</del>")
+	assertContains(t, w, "<ins>+ We make good things</ins>")
+
+	// Stale translation is still shown to readers
+	assertContains(t, tc.get("/ru/pages/about"), "Мы делаем вещи")
+
+	// Saving the translation again makes it up to date
+	translatePage(t, tc, page, "ru", url.Values{"title": {"О нас"}, "content": {"Мы делаем хорошие вещи"}})
+	w = tc.getJSON(path)
+	assertStatus(t, w, http.StatusOK)
+	var statuses struct {
+		SourceLocale string                  `json:"source_locale"`
+		Translations []pageTranslationStatus `json:"translations"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if statuses.SourceLocale != "en" || len(statuses.Translations) != 1 || statuses.Translations[0].Stale || statuses.Translations[0].Translation == nil {
+		t.Fatalf("expected up to date ru translation, got %+v", statuses)
+	}
+
+	assertContains(t, tc.follow(tc.post(path+"/ru/delete", url.Values{})), "Translation was deleted.")
+	w = tc.post(path+"/ru/delete", url.Values{})
+	assertRedirect(t, w, path)
+	assertContains(t, tc.follow(w), "Translation not found")
+	assertContains(t, tc.get("/ru/pages/about"), "We make good things")
+}
+
+func TestPurgePageDeletesTranslations(t *testing.T) {
+	a := newTestApp(t)
+	tc := loginAsAdmin(t, a)
+	page := createPage(t, a, Page{Slug: "about", Content: "We make things"})
+	translatePage(t, tc, page, "ru", url.Values{"content": {"Мы делаем вещи"}})
+
+	ctx := context.Background()
+	if err := a.Pages.Delete(ctx, &page); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Pages.Purge(ctx, &page); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	a.DB.Model(&PageTranslation{}).Where("page_id = ?", page.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected translations to be purged, got %d", count)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Deleted users and pages are kept in trash for TRASH_RETENTION (Go duration, 30 days by default, "0" keeps them forever)
+const trashDefaultRetention = 30 * 24 * time.Hour
+
+// How often trash is checked for expired records
+const trashPurgeInterval = time.Hour
+
+// purgeTrash permanently deletes users and pages deleted before the retention period
+func (a *App) purgeTrash(ctx context.Context) error {
+	retention := a.Config.TrashRetention
+	if retention == 0 {
+		return nil
+	}
+
+	before := a.now().Add(-retention)
+	if err := a.Users.PurgeDeletedBefore(ctx, before); err != nil {
+		return err
+	}
+	return a.Pages.PurgeDeletedBefore(ctx, before)
+}
+
+// startTrashPurger runs purgeTrash periodically until ctx is done. Returned channel is closed when it stops.
+func (a *App) startTrashPurger(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := a.purgeTrash(ctx); err != nil {
+				a.Logger.Error("Failed to purge trash", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+func (a *App) actionAdminTrashIndex(c *gin.Context) {
+	users, err := a.Users.ListTrashed(c.Request.Context())
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+
+	pages, err := a.Pages.ListTrashed(c.Request.Context())
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "admin/error.html", addFlashesAndUser(c, &gin.H{"errors": []string{err.Error()}}))
+		return
+	}
+
+	renderHTML(c, http.StatusOK, "admin/trash/index.html", addFlashesAndUser(c, &gin.H{"users": users, "pages": pages, "retention": a.Config.TrashRetention}))
+}
+
+func (a *App) actionAdminTrashUsersRestore(c *gin.Context) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+
+	user, err := a.Users.FindTrashed(ctx, paramID(c, "id"))
+	if err != nil {
+		session.AddFlash(tr(c, "User not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	// Login could be taken by another user while this one was in trash
+	taken, err := a.Users.LoginTaken(ctx, user.Login)
+	if err != nil {
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+	if taken {
+		session.AddFlash(tr(c, "User can't be restored: login %s is already used.", user.Login))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	if err := a.Users.Restore(ctx, &user); err != nil {
+		session.AddFlash(err.Error())
+	} else {
+		a.audit(c, "restore", "user", user.ID, nil, nil)
+		session.AddFlash(tr(c, "User was restored."))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/trash")
+}
+
+func (a *App) actionAdminTrashUsersDestroy(c *gin.Context) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+
+	user, err := a.Users.FindTrashed(ctx, paramID(c, "id"))
+	if err != nil {
+		session.AddFlash(tr(c, "User not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	if err := a.Users.Purge(ctx, &user); err != nil {
+		session.AddFlash(err.Error())
+	} else {
+		a.audit(c, "purge", "user", user.ID, user, nil)
+		session.AddFlash(tr(c, "User was permanently deleted."))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/trash")
+}
+
+func (a *App) actionAdminTrashPagesRestore(c *gin.Context) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+
+	page, err := a.Pages.FindTrashed(ctx, paramID(c, "id"))
+	if err != nil {
+		session.AddFlash(tr(c, "Page not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	// Slug could be taken by another page while this one was in trash
+	taken, err := a.Pages.SlugTaken(ctx, page.Slug)
+	if err != nil {
+		session.AddFlash(err.Error())
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+	if taken {
+		session.AddFlash(tr(c, "Page can't be restored: slug %s is already used.", page.Slug))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	if err := a.Pages.Restore(ctx, &page); err != nil {
+		session.AddFlash(err.Error())
+	} else {
+		a.audit(c, "restore", "page", page.ID, nil, nil)
+		a.invalidateSEOCache()
+		session.AddFlash(tr(c, "Page was restored."))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/trash")
+}
+
+func (a *App) actionAdminTrashPagesDestroy(c *gin.Context) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+
+	page, err := a.Pages.FindTrashed(ctx, paramID(c, "id"))
+	if err != nil {
+		session.AddFlash(tr(c, "Page not found"))
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/admin/trash")
+		return
+	}
+
+	if err := a.Pages.Purge(ctx, &page); err != nil {
+		session.AddFlash(err.Error())
+	} else {
+		a.audit(c, "purge", "page", page.ID, page, nil)
+		session.AddFlash(tr(c, "Page was permanently deleted."))
+	}
+	session.Save()
+
+	c.Redirect(http.StatusSeeOther, "/admin/trash")
+}